@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/models"
+)
+
+/*
+Every "can this user do that?" decision lives here, so the rules are written once and the handlers just ask.
+
+  - public snippets can be seen by anyone who can reach the page
+  - private snippets can be seen by their owner, and by the owner and members of any collection they were added to
+  - collections can be seen by their owner and members, only the owner and "write" members can change the snippets in them, and only the owner can manage members
+*/
+
+// authenticatedUserID returns the ID of the logged in user, or 0 for anonymous requests
+func (app *application) authenticatedUserID(r *http.Request) int {
+	if !app.isAuthenticated(r) {
+		return 0
+	}
+
+	return app.sessionManager.GetInt(r.Context(), authenticatedUserIDSessionKey)
+}
+
+func (app *application) canViewSnippet(r *http.Request, snippet models.Snippet) (bool, error) {
+	if !snippet.Private {
+		return true, nil
+	}
+
+	userID := app.authenticatedUserID(r)
+	if userID == 0 {
+		return false, nil
+	}
+
+	if snippet.UserID == userID {
+		return true, nil
+	}
+
+	return app.collections.SharesSnippet(r.Context(), snippet.ID, userID)
+}
+
+// canAddToCollection decides which snippets may be put in a collection. Anything in a collection becomes visible to all of its members, so you can only add public snippets or your own private ones, never someone else's private snippet that was shared with you.
+func (app *application) canAddToCollection(r *http.Request, snippet models.Snippet) bool {
+	return !snippet.Private || snippet.UserID == app.authenticatedUserID(r)
+}
+
+// getCollection loads a collection with the permission of the current user on it, and returns models.ErrNoRecord when the user isn't allowed to see it, so it's impossible to tell a private collection apart from one that doesn't exist
+func (app *application) getCollection(r *http.Request, id int) (models.Collection, error) {
+	collection, err := app.collections.Get(r.Context(), id, app.authenticatedUserID(r))
+	if err != nil {
+		return models.Collection{}, err
+	}
+
+	if collection.Permission == models.PermissionNone {
+		return models.Collection{}, models.ErrNoRecord
+	}
+
+	return collection, nil
+}
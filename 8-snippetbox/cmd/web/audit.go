@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/models"
+)
+
+// audit records a security relevant event for userID, with the IP address and user agent of the request. Like the view counter, a failure is only logged: the user already did the thing, refusing it now because the audit log is down wouldn't undo it.
+func (app *application) audit(r *http.Request, event string, userID, snippetID int) {
+	err := app.audits.Record(r.Context(), models.AuditEvent{
+		UserID:    userID,
+		Event:     event,
+		SnippetID: snippetID,
+		IP:        clientIP(r),
+		UserAgent: userAgent(r),
+	})
+	if err != nil {
+		app.logger.WarnContext(r.Context(), "failed to record audit event", "event", event, "user_id", userID, "error", err.Error())
+	}
+}
+
+// auditLoginFailure records a failed login on the account of email, so its owner can see someone tried to get in. Emails nobody signed up with are recorded without a user.
+func (app *application) auditLoginFailure(r *http.Request, email string) {
+	user, err := app.users.GetByEmail(r.Context(), email)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.logger.WarnContext(r.Context(), "failed to record audit event", "event", models.AuditLoginFailure, "error", err.Error())
+		return
+	}
+
+	app.audit(r, models.AuditLoginFailure, user.ID, 0)
+}
+
+// account shows the current user their logged in sessions and their own recent activity, so they can spot logins they don't recognize and log them out. It's also where they pick their language and time zone.
+func (app *application) account(w http.ResponseWriter, r *http.Request) {
+	app.renderAccount(w, r, http.StatusOK, nil)
+}
+
+// renderAccount renders the account page, with the time zone form a POST failed to validate when it isn't nil
+func (app *application) renderAccount(w http.ResponseWriter, r *http.Request, status int, timeZone *timeZoneForm) {
+	user, err := app.users.Get(r.Context(), app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	events, err := app.audits.ForUser(r.Context(), app.authenticatedUserID(r), 50)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	sessions, err := app.userSessions.ForUser(r.Context(), app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if timeZone == nil {
+		timeZone = &timeZoneForm{TimeZone: user.TimeZone}
+	}
+
+	data := app.newTemplateData(r, accountTemplateData{
+		Events:           events,
+		Sessions:         sessions,
+		CurrentSessionID: app.sessionManager.GetString(r.Context(), userSessionIDSessionKey),
+		LocalePreference: user.Locale,
+		TimeZoneForm:     *timeZone,
+	})
+	app.render(w, r, status, "account.tmpl.html", data)
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/models"
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/validator"
+)
+
+func (app *application) collectionList(w http.ResponseWriter, r *http.Request) {
+	app.renderCollections(w, r, http.StatusOK, collectionCreateForm{})
+}
+
+func (app *application) renderCollections(w http.ResponseWriter, r *http.Request, status int, form collectionCreateForm) {
+	collections, err := app.collections.ForUser(r.Context(), app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r, collectionsTemplateData{
+		Collections: collections,
+		Form:        form,
+	})
+
+	app.render(w, r, status, "collections.tmpl.html", data)
+}
+
+func (app *application) collectionCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form collectionCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", app.t(r, "This field cannot be blank"))
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", app.t(r, "This field cannot be more than %d characters long", 100))
+
+	if !form.Valid() {
+		app.renderCollections(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	id, err := app.collections.Insert(r.Context(), app.authenticatedUserID(r), form.Name)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateName) {
+			form.AddFormError("name", app.t(r, "You already have a collection with this name"))
+			app.renderCollections(w, r, http.StatusUnprocessableEntity, form)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", app.t(r, "Collection successfully created!"))
+
+	http.Redirect(w, r, fmt.Sprintf("/collection/view/%d", id), http.StatusSeeOther)
+}
+
+func (app *application) collectionView(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	collection, err := app.getCollection(r, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	app.renderCollection(w, r, http.StatusOK, collectionTemplateData{Collection: collection})
+}
+
+// renderCollection fills in the snippets and members of data.Collection and renders the collection page, the forms in data are kept as they are so validation errors are displayed
+func (app *application) renderCollection(w http.ResponseWriter, r *http.Request, status int, data collectionTemplateData) {
+	snippets, err := app.collections.Snippets(r.Context(), data.Collection.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	members, err := app.collections.Members(r.Context(), data.Collection.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Snippets = snippets
+	data.Members = members
+
+	if data.ShareForm.Permission == "" {
+		data.ShareForm.Permission = models.PermissionRead
+	}
+
+	app.render(w, r, status, "collection.tmpl.html", app.newTemplateData(r, data))
+}
+
+// collectionForPost loads the collection a form is about and checks the current user has the permission to change it. It writes the error response itself and returns false when the handler should stop.
+func (app *application) collectionForPost(w http.ResponseWriter, r *http.Request, id int, allowed func(models.Collection) bool) (models.Collection, bool) {
+	collection, err := app.getCollection(r, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return models.Collection{}, false
+	}
+
+	if !allowed(collection) {
+		app.clientError(w, http.StatusForbidden)
+		return models.Collection{}, false
+	}
+
+	return collection, true
+}
+
+func isCollectionOwner(c models.Collection) bool {
+	return c.Permission == models.PermissionOwner
+}
+
+func (app *application) collectionAddPost(w http.ResponseWriter, r *http.Request) {
+	var form collectionSnippetForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	collection, ok := app.collectionForPost(w, r, form.CollectionID, models.Collection.CanWrite)
+	if !ok {
+		return
+	}
+
+	snippet, err := app.snippets.Get(r.Context(), form.SnippetID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	form.CheckField(err == nil, "snippet_id", app.t(r, "There is no snippet with this ID"))
+	if err == nil {
+		form.CheckField(app.canAddToCollection(r, snippet), "snippet_id", app.t(r, "You can only add public snippets or your own private snippets"))
+	}
+
+	if !form.Valid() {
+		app.renderCollection(w, r, http.StatusUnprocessableEntity, collectionTemplateData{Collection: collection, AddForm: form})
+		return
+	}
+
+	err = app.collections.AddSnippet(r.Context(), collection.ID, snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", app.t(r, "Snippet added to %s", collection.Name))
+
+	http.Redirect(w, r, fmt.Sprintf("/collection/view/%d", collection.ID), http.StatusSeeOther)
+}
+
+func (app *application) collectionRemovePost(w http.ResponseWriter, r *http.Request) {
+	var form collectionSnippetForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	collection, ok := app.collectionForPost(w, r, form.CollectionID, models.Collection.CanWrite)
+	if !ok {
+		return
+	}
+
+	err = app.collections.RemoveSnippet(r.Context(), collection.ID, form.SnippetID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", app.t(r, "Snippet removed from %s", collection.Name))
+
+	http.Redirect(w, r, fmt.Sprintf("/collection/view/%d", collection.ID), http.StatusSeeOther)
+}
+
+func (app *application) collectionSharePost(w http.ResponseWriter, r *http.Request) {
+	var form collectionShareForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	collection, ok := app.collectionForPost(w, r, form.CollectionID, isCollectionOwner)
+	if !ok {
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", app.t(r, "This field cannot be blank"))
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", app.t(r, "This field must be a valid email"))
+	form.CheckField(validator.PermittedValue(form.Permission, models.SharePermissions...), "permission", app.t(r, "This field must equal read or write"))
+
+	var user models.User
+	if form.Valid() {
+		user, err = app.users.GetByEmail(r.Context(), form.Email)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+
+		form.CheckField(err == nil, "email", app.t(r, "There is no user with this email"))
+		form.CheckField(user.ID != collection.UserID, "email", app.t(r, "You already own this collection"))
+	}
+
+	if !form.Valid() {
+		app.renderCollection(w, r, http.StatusUnprocessableEntity, collectionTemplateData{Collection: collection, ShareForm: form})
+		return
+	}
+
+	err = app.collections.Share(r.Context(), collection.ID, user.ID, form.Permission)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", app.t(r, "Collection shared with %s", user.Name))
+
+	http.Redirect(w, r, fmt.Sprintf("/collection/view/%d", collection.ID), http.StatusSeeOther)
+}
+
+// collectionUnsharePost removes a member. The owner can remove anyone, and members can remove themselves to leave a collection.
+func (app *application) collectionUnsharePost(w http.ResponseWriter, r *http.Request) {
+	var form collectionUnshareForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	collection, ok := app.collectionForPost(w, r, form.CollectionID, func(c models.Collection) bool {
+		return isCollectionOwner(c) || form.UserID == userID
+	})
+	if !ok {
+		return
+	}
+
+	err = app.collections.Unshare(r.Context(), collection.ID, form.UserID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if form.UserID == userID {
+		app.sessionManager.Put(r.Context(), "flash", app.t(r, "You left %s", collection.Name))
+		http.Redirect(w, r, "/collections", http.StatusSeeOther)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", app.t(r, "Member removed"))
+
+	http.Redirect(w, r, fmt.Sprintf("/collection/view/%d", collection.ID), http.StatusSeeOther)
+}
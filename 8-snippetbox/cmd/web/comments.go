@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/models"
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/validator"
+)
+
+// commentCreatePost posts a comment that starts a thread, optionally anchored to a range of lines, or a reply to another comment of the same snippet. Anyone who can see a snippet can comment on it.
+func (app *application) commentCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form commentForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	snippet, ok := app.viewableSnippet(w, r, form.SnippetID)
+	if !ok {
+		return
+	}
+
+	if form.ParentID != 0 {
+		parent, err := app.comments.Get(r.Context(), form.ParentID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+
+		// the reply forms are on the page of the snippet, so a parent from somewhere else means the form was tampered with
+		if err != nil || parent.SnippetID != snippet.ID {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	form.CheckField(validator.NotBlank(form.Content), "content", app.t(r, "This field cannot be blank"))
+	form.CheckField(validator.MaxChars(form.Content, 2000), "content", app.t(r, "This field cannot be more than %d characters long", 2000))
+
+	// a single line can be given as just the start of the range
+	if form.LineEnd == 0 {
+		form.LineEnd = form.LineStart
+	}
+
+	if form.LineStart != 0 || form.LineEnd != 0 {
+		form.CheckField(!snippet.Encrypted, "lines", app.t(r, "Comments on encrypted snippets can't be anchored to lines"))
+		form.CheckField(form.ParentID == 0, "lines", app.t(r, "Replies can't be anchored to lines, they belong to the thread they reply to"))
+
+		if form.File >= 0 && form.File < len(snippet.Files) {
+			lines := len(snippetLines(snippet.Files[form.File].Content))
+			form.CheckField(form.LineStart >= 1 && form.LineStart <= form.LineEnd && form.LineEnd <= lines, "lines", app.t(r, "This field must be a range of lines between 1 and %d", lines))
+		} else {
+			form.AddFormError("file", app.t(r, "This field must be one of the files of the snippet"))
+		}
+	} else {
+		// the file only matters for comments anchored to lines
+		form.File = 0
+	}
+
+	if !form.Valid() {
+		app.renderSnippet(w, r, http.StatusUnprocessableEntity, snippetViewTemplateData{Snippet: snippet, CommentForm: form})
+		return
+	}
+
+	id, err := app.comments.Insert(r.Context(), models.Comment{
+		SnippetID: snippet.ID,
+		UserID:    app.authenticatedUserID(r),
+		ParentID:  form.ParentID,
+		File:      form.File,
+		LineStart: form.LineStart,
+		LineEnd:   form.LineEnd,
+		Content:   form.Content,
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", app.t(r, "Comment posted!"))
+
+	http.Redirect(w, r, commentURL(snippet, id), http.StatusSeeOther)
+}
+
+// commentURL is where to go back to after changing a comment. The key of encrypted snippets is in the fragment of the URL: main.js adds it to the URL of the forms, and browsers keep the fragment of the request when the redirect doesn't have one, so those redirects can't jump to the comment.
+func commentURL(snippet models.Snippet, commentID int) string {
+	if snippet.Encrypted {
+		return fmt.Sprintf("/snippet/view/%d", snippet.ID)
+	}
+
+	return fmt.Sprintf("/snippet/view/%d#comment-%d", snippet.ID, commentID)
+}
+
+// authoredComment loads a comment and checks it was written by the current user, only authors can edit or delete their comments. It writes the error response itself and returns false when the handler should stop.
+func (app *application) authoredComment(w http.ResponseWriter, r *http.Request, id int) (models.Comment, bool) {
+	comment, err := app.comments.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return models.Comment{}, false
+	}
+
+	if comment.UserID != app.authenticatedUserID(r) {
+		app.clientError(w, http.StatusForbidden)
+		return models.Comment{}, false
+	}
+
+	return comment, true
+}
+
+func (app *application) commentEditPost(w http.ResponseWriter, r *http.Request) {
+	var form commentEditForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	comment, ok := app.authoredComment(w, r, form.CommentID)
+	if !ok {
+		return
+	}
+
+	// authors who lost access to a private snippet lose access to their comments on it too
+	snippet, ok := app.viewableSnippet(w, r, comment.SnippetID)
+	if !ok {
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Content), "content", app.t(r, "This field cannot be blank"))
+	form.CheckField(validator.MaxChars(form.Content, 2000), "content", app.t(r, "This field cannot be more than %d characters long", 2000))
+
+	if !form.Valid() {
+		app.renderSnippet(w, r, http.StatusUnprocessableEntity, snippetViewTemplateData{Snippet: snippet, EditForm: form})
+		return
+	}
+
+	err = app.comments.Update(r.Context(), comment.ID, form.Content)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", app.t(r, "Comment updated!"))
+
+	http.Redirect(w, r, commentURL(snippet, comment.ID), http.StatusSeeOther)
+}
+
+// commentDeletePost deletes a comment together with the replies in its thread
+func (app *application) commentDeletePost(w http.ResponseWriter, r *http.Request) {
+	var form commentDeleteForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	comment, ok := app.authoredComment(w, r, form.CommentID)
+	if !ok {
+		return
+	}
+
+	snippet, ok := app.viewableSnippet(w, r, comment.SnippetID)
+	if !ok {
+		return
+	}
+
+	err = app.comments.Delete(r.Context(), comment.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", app.t(r, "Comment deleted"))
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
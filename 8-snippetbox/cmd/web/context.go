@@ -8,4 +8,22 @@ type contextKey string
 // When making comparisons, go with check type and values so isAuthenticatedContextKey == "isAuthenticated" will be false
 const isAuthenticatedContextKey = contextKey("isAuthenticated")
 
+// Set by the authenticate middleware next to isAuthenticatedContextKey
+const isModeratorContextKey = contextKey("isModerator")
+
+// The locale the logged in user picked, also set by authenticate, see locale.go
+const localePreferenceContextKey = contextKey("localePreference")
+
+// The time zone the logged in user picked, also set by authenticate, see timezone.go
+const timeZonePreferenceContextKey = contextKey("timeZonePreference")
+
 const authenticatedUserIDSessionKey = "authenticatedUserId"
+
+// The ID of the row in user_sessions of a logged in session, see sessions.go
+const userSessionIDSessionKey = "userSessionId"
+
+// The request ID is set by the requestID middleware for every request, and picked up by the contextHandler so it ends up in every log line
+const requestIDContextKey = contextKey("requestID")
+
+// The nonce of the Content-Security-Policy of the request, set by commonHeaders, see csp.go
+const cspNonceContextKey = contextKey("cspNonce")
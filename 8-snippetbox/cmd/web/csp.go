@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+/*
+The Content-Security-Policy is sent by commonHeaders on every response. The policy comes from -csp, with every "{nonce}" in it replaced by a random value that is new for every request. Scripts only run when their nonce attribute matches, so a script injected into a page can't run because the attacker can't know the nonce in advance.
+
+Browsers report what the policy blocked to /csp-report, in one of two formats depending on the browser, see cspReportPost. With -csp-report-only the policy is sent as Content-Security-Policy-Report-Only instead, which reports without blocking anything, so a stricter policy can be tried out on real traffic before it's enforced.
+*/
+
+// The placeholder in -csp that is replaced with the nonce of the request
+const cspNoncePlaceholder = "{nonce}"
+
+// Name of the endpoint in the Reporting-Endpoints header, report-to refers to it
+const cspReportEndpoint = "csp-endpoint"
+
+// Reports are small, anything bigger than this isn't a report
+const maxCSPReportBytes = 64 * 1024
+
+func newCSPNonce() string {
+	b := make([]byte, 16)
+	// crypto/rand.Read never returns an error on the platforms we support, see https://pkg.go.dev/crypto/rand#Read
+	rand.Read(b)
+
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// cspNonce returns the nonce of the current request, for the nonce attribute of scripts
+func cspNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(cspNonceContextKey).(string)
+	return nonce
+}
+
+/*
+setCSP sends the policy for this request with its nonce.
+
+The nonce is made by the requestID middleware, which puts it in the context along with the ID. It can't be made here: this runs after traceRequest, and replacing the request this far down would hide r.Pattern from traceRequest, the servemux sets it on the request it gets, which would no longer be the one traceRequest holds.
+*/
+func (app *application) setCSP(w http.ResponseWriter, r *http.Request) {
+	nonce := cspNonce(r)
+
+	/*
+	  report-uri is the old way of asking for reports and report-to the new one. Browsers that know report-to ignore report-uri, so sending both covers everybody.
+	*/
+	policy := strings.ReplaceAll(app.config.CSP, cspNoncePlaceholder, nonce)
+	policy += "; report-uri /csp-report; report-to " + cspReportEndpoint
+
+	header := "Content-Security-Policy"
+	if app.config.CSPReportOnly {
+		header = "Content-Security-Policy-Report-Only"
+	}
+
+	w.Header().Set(header, policy)
+	w.Header().Set("Reporting-Endpoints", fmt.Sprintf(`%s="/csp-report"`, cspReportEndpoint))
+}
+
+// cspViolation is what we keep of a violation report, the two formats below use different names for the same things
+type cspViolation struct {
+	DocumentURL string
+	BlockedURL  string
+	Directive   string
+	SourceFile  string
+	LineNumber  int
+	Disposition string
+}
+
+// The body of a report-uri report, sent as application/csp-report
+type cspReportURIBody struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		BlockedURI         string `json:"blocked-uri"`
+		EffectiveDirective string `json:"effective-directive"`
+		ViolatedDirective  string `json:"violated-directive"`
+		SourceFile         string `json:"source-file"`
+		LineNumber         int    `json:"line-number"`
+		Disposition        string `json:"disposition"`
+	} `json:"csp-report"`
+}
+
+// The body of a Reporting API report, sent as application/reports+json. It's a list, and can hold other types of reports than CSP violations.
+type cspReportToBody []struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		BlockedURL         string `json:"blockedURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		SourceFile         string `json:"sourceFile"`
+		LineNumber         int    `json:"lineNumber"`
+		Disposition        string `json:"disposition"`
+	} `json:"body"`
+}
+
+/*
+cspReportPost logs the violations browsers report. It's registered without the session and CSRF middleware, browsers send reports without cookies or tokens.
+
+Anyone can post here, so the reports are limited per IP address, and a page full of violations can't flood the logs. A report over the limit gets a 429 without a page, nobody is looking at the response anyway.
+*/
+func (app *application) cspReportPost(w http.ResponseWriter, r *http.Request) {
+	key := "csp-report:ip:" + clientIP(r)
+
+	ok, _, err := app.cspLimiter.Allow(r.Context(), key)
+	if err != nil {
+		app.logger.WarnContext(r.Context(), "rate limiter failed", "key", key, "error", err.Error())
+	} else if !ok {
+		app.clientError(w, http.StatusTooManyRequests)
+		return
+	}
+
+	violations, err := decodeCSPReport(r)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	for _, violation := range violations {
+		app.logger.WarnContext(r.Context(), "content security policy violation",
+			"document", violation.DocumentURL,
+			"blocked", violation.BlockedURL,
+			"directive", violation.Directive,
+			"source", violation.SourceFile,
+			"line", violation.LineNumber,
+			"disposition", violation.Disposition,
+			"ip", clientIP(r),
+		)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeCSPReport reads a report in either format, telling them apart by their content type
+func decodeCSPReport(r *http.Request) ([]cspViolation, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+
+	switch mediaType {
+	case "application/csp-report":
+		var body cspReportURIBody
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			return nil, err
+		}
+
+		report := body.Report
+
+		// older browsers only send violated-directive
+		directive := report.EffectiveDirective
+		if directive == "" {
+			directive = report.ViolatedDirective
+		}
+
+		return []cspViolation{{
+			DocumentURL: report.DocumentURI,
+			BlockedURL:  report.BlockedURI,
+			Directive:   directive,
+			SourceFile:  report.SourceFile,
+			LineNumber:  report.LineNumber,
+			Disposition: report.Disposition,
+		}}, nil
+
+	case "application/reports+json":
+		var body cspReportToBody
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			return nil, err
+		}
+
+		var violations []cspViolation
+		for _, report := range body {
+			if report.Type != "csp-violation" {
+				continue
+			}
+
+			violations = append(violations, cspViolation{
+				DocumentURL: report.Body.DocumentURL,
+				BlockedURL:  report.Body.BlockedURL,
+				Directive:   report.Body.EffectiveDirective,
+				SourceFile:  report.Body.SourceFile,
+				LineNumber:  report.Body.LineNumber,
+				Disposition: report.Body.Disposition,
+			})
+		}
+
+		return violations, nil
+	}
+
+	return nil, fmt.Errorf("unsupported report content type %q", mediaType)
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/models"
+)
+
+/*
+Atom feeds of the latest public snippets, /feed.atom for everybody's and /user/{id}/feed.atom for one author's. They are registered without the session middleware, feed readers don't log in.
+
+Feed readers ask for the same feed every few minutes, and most of the time nothing changed. So every response has an ETag and a Last-Modified, and a reader that sends them back (If-None-Match and If-Modified-Since) gets a 304 without a body. Finding out whether anything changed only takes models.SnippetModel.LatestVersions, the snippets themselves are only loaded when there is a feed to send.
+*/
+
+// Readers that respect it wait this long before asking again, a new snippet shows up in the feed a few minutes late at worst
+const feedMaxAge = 5 * time.Minute
+
+// The XML of an Atom feed, see RFC 4287. Only what we fill in is here.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomPerson  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// baseURL is where the site is reachable, without a trailing slash, for the absolute links feeds need
+func (app *application) baseURL(r *http.Request) string {
+	if app.config.BaseURL != "" {
+		return strings.TrimSuffix(app.config.BaseURL, "/")
+	}
+
+	return "https://" + r.Host
+}
+
+// feed is the feed of the latest public snippets of everybody
+func (app *application) feed(w http.ResponseWriter, r *http.Request) {
+	app.serveFeed(w, r, models.User{})
+}
+
+// userFeed is the feed of the latest public snippets of one user, banned users don't have one
+func (app *application) userFeed(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	user, err := app.users.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if user.Banned {
+		http.NotFound(w, r)
+		return
+	}
+
+	app.serveFeed(w, r, user)
+}
+
+// serveFeed answers conditional requests from LatestVersions, and only loads the snippets for a full response. author is the zero value for the feed of everybody.
+func (app *application) serveFeed(w http.ResponseWriter, r *http.Request, author models.User) {
+	locale := app.locale(r)
+
+	versions, err := app.snippets.LatestVersions(r.Context(), author.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	ids := make([]int, len(versions))
+	var updated time.Time
+	for i, version := range versions {
+		ids[i] = version.ID
+		if version.Created.After(updated) {
+			updated = version.Created
+		}
+	}
+
+	// the titles are translated, Accept-Language is the only thing that picks the locale here since there is no session
+	w.Header().Set("Vary", "Accept-Language")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(feedMaxAge.Seconds())))
+	setFeedValidators(w, feedETag(ids, locale.Code()), updated)
+
+	if notModified(r, w.Header().Get("ETag"), updated) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var snippets []models.Snippet
+	if author.ID == 0 {
+		snippets, err = app.snippets.Latest(r.Context())
+	} else {
+		snippets, err = app.snippets.LatestBy(r.Context(), author.ID)
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// a snippet could have been created since LatestVersions, the validators have to describe the feed that is actually sent
+	ids = ids[:0]
+	for _, snippet := range snippets {
+		ids = append(ids, snippet.ID)
+		if snippet.Created.After(updated) {
+			updated = snippet.Created
+		}
+	}
+	setFeedValidators(w, feedETag(ids, locale.Code()), updated)
+
+	base := app.baseURL(r)
+
+	feed := atomFeed{
+		ID:      base + r.URL.Path,
+		Title:   locale.T("Latest Snippets") + " - Snippetbox",
+		Updated: updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: base + r.URL.Path},
+			{Rel: "alternate", Type: "text/html", Href: base + "/"},
+		},
+		// Atom wants an author for every entry, the one of the feed counts for all of them
+		Author: atomPerson{Name: "Snippetbox", URI: base + "/"},
+	}
+
+	if author.ID != 0 {
+		feed.Title = locale.T("Snippets by %s", author.Name) + " - Snippetbox"
+		feed.Author = atomPerson{Name: author.Name}
+	}
+
+	// an empty feed still needs an updated date, one that never changes so it doesn't look like there is something new
+	if updated.IsZero() {
+		feed.Updated = time.Unix(0, 0).UTC().Format(time.RFC3339)
+	}
+
+	for _, snippet := range snippets {
+		link := fmt.Sprintf("%s/snippet/view/%d", base, snippet.ID)
+
+		entry := atomEntry{
+			ID:        link,
+			Title:     snippet.Title,
+			Published: snippet.Created.UTC().Format(time.RFC3339),
+			// snippets can't be edited, so they are as new as they were when they were created
+			Updated: snippet.Created.UTC().Format(time.RFC3339),
+			Links:   []atomLink{{Rel: "alternate", Type: "text/html", Href: link}},
+			Content: atomContent{Type: "html", Body: feedContent(snippet)},
+		}
+
+		for _, tag := range snippet.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	// encoded into a buffer first, like the templates in render, so an error can still be a 500
+	buf := new(bytes.Buffer)
+	buf.WriteString(xml.Header)
+
+	err = xml.NewEncoder(buf).Encode(feed)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	buf.WriteTo(w)
+}
+
+// feedContent is the HTML of an entry, every file with its name. It's escaped again by the XML encoder, that's how Atom carries HTML.
+func feedContent(snippet models.Snippet) string {
+	var b strings.Builder
+
+	for _, file := range snippet.Files {
+		fmt.Fprintf(&b, "<h3>%s</h3>\n<pre>%s</pre>\n", html.EscapeString(file.Name), html.EscapeString(file.Content))
+	}
+
+	return b.String()
+}
+
+// feedETag identifies a feed by the snippets in it and its language, which is all that can change about it
+func feedETag(ids []int, locale string) string {
+	h := sha256.New()
+	fmt.Fprint(h, locale, ids)
+
+	return `"` + hex.EncodeToString(h.Sum(nil))[:32] + `"`
+}
+
+func setFeedValidators(w http.ResponseWriter, etag string, updated time.Time) {
+	w.Header().Set("ETag", etag)
+
+	if !updated.IsZero() {
+		w.Header().Set("Last-Modified", updated.UTC().Format(http.TimeFormat))
+	}
+}
+
+/*
+notModified tells whether the reader already has the current feed, following the rules of RFC 9110 section 13.2.2: If-None-Match wins when it's there, If-Modified-Since is only looked at without it. http.ServeContent does the same, but it needs the body, which is what we want to avoid building.
+
+Last-Modified is when the newest snippet was created, so it doesn't move when a snippet expires or is hidden. Readers that only send If-Modified-Since keep such a snippet until the next new one, but feed readers keep old entries around anyway.
+*/
+func notModified(r *http.Request, etag string, updated time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+
+			// weak comparison, a W/ in front doesn't matter for a GET
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || updated.IsZero() {
+		return false
+	}
+
+	// Last-Modified only has whole seconds
+	return !updated.Truncate(time.Second).After(since)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotModified(t *testing.T) {
+	const etag = `"abc123"`
+
+	updated := time.Date(2026, 10, 19, 12, 30, 15, 500, time.UTC)
+	before := updated.Add(-time.Hour).Format(http.TimeFormat)
+	same := updated.Format(http.TimeFormat)
+	after := updated.Add(time.Hour).Format(http.TimeFormat)
+
+	tests := []struct {
+		name            string
+		ifNoneMatch     string
+		ifModifiedSince string
+		updated         time.Time
+		want            bool
+	}{
+		{name: "No validators", updated: updated, want: false},
+		{name: "Same ETag", ifNoneMatch: etag, updated: updated, want: true},
+		{name: "Weak ETag", ifNoneMatch: `W/"abc123"`, updated: updated, want: true},
+		{name: "One of several ETags", ifNoneMatch: `"old", "abc123"`, updated: updated, want: true},
+		{name: "Any ETag", ifNoneMatch: "*", updated: updated, want: true},
+		{name: "Other ETag", ifNoneMatch: `"old"`, updated: updated, want: false},
+		{name: "Same second, sub-second part ignored", ifModifiedSince: same, updated: updated, want: true},
+		{name: "Modified since", ifModifiedSince: before, updated: updated, want: false},
+		{name: "Not modified since", ifModifiedSince: after, updated: updated, want: true},
+		{name: "Unparsable date", ifModifiedSince: "yesterday", updated: updated, want: false},
+		{name: "Feed without snippets", ifModifiedSince: after, want: false},
+		// If-Modified-Since is ignored when If-None-Match is there, whichever way they point
+		{name: "Other ETag wins over an old date", ifNoneMatch: `"old"`, ifModifiedSince: after, updated: updated, want: false},
+		{name: "Same ETag wins over a new date", ifNoneMatch: etag, ifModifiedSince: before, updated: updated, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/feed.atom", nil)
+			if tt.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			if tt.ifModifiedSince != "" {
+				r.Header.Set("If-Modified-Since", tt.ifModifiedSince)
+			}
+
+			if got := notModified(r, etag, tt.updated); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
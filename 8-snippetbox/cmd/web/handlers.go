@@ -1,18 +1,23 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/markdown"
 	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/models"
 	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/validator"
 )
 
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
-	snippets, err := app.snippets.Latest()
+	snippets, err := app.snippets.Latest(r.Context())
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -33,31 +38,230 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	snippet, err := app.snippets.Get(id)
-	if err != nil {
-		if errors.Is(err, models.ErrNoRecord) {
-			http.NotFound(w, r)
-		} else {
+	snippet, ok := app.viewableSnippet(w, r, id)
+	if !ok {
+		return
+	}
+
+	// authors looking at their own snippets don't make them any more popular
+	if snippet.UserID == 0 || snippet.UserID != app.authenticatedUserID(r) {
+		app.views.add(snippet.ID, 1)
+	}
+
+	app.renderSnippet(w, r, http.StatusOK, snippetViewTemplateData{Snippet: snippet})
+}
+
+// renderSnippet fills in everything that is displayed around data.Snippet and renders the view page, the comment forms in data are kept as they are so validation errors are displayed
+func (app *application) renderSnippet(w http.ResponseWriter, r *http.Request, status int, data snippetViewTemplateData) {
+	snippet := data.Snippet
+
+	var writable []models.Collection
+	if app.canAddToCollection(r, snippet) {
+		collections, err := app.collections.ForUser(r.Context(), app.authenticatedUserID(r))
+		if err != nil {
 			app.serverError(w, r, err)
+			return
+		}
+
+		for _, collection := range collections {
+			if collection.CanWrite() {
+				writable = append(writable, collection)
+			}
+		}
+	}
+
+	// the link to the original is only shown to people who are allowed to follow it
+	var forkedFrom models.Snippet
+	if snippet.ForkedFromID != 0 {
+		original, err := app.snippets.Get(r.Context(), snippet.ForkedFromID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if err == nil {
+			allowed, err := app.canViewSnippet(r, original)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
+			if allowed {
+				forkedFrom = original
+			}
+		}
+	}
+
+	forks, err := app.snippets.Forks(r.Context(), snippet.ID, app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	comments, err := app.comments.ForSnippet(r.Context(), snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	starred, err := app.snippets.Starred(r.Context(), snippet.ID, app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Collections = writable
+	data.ForkedFrom = forkedFrom
+	data.Forks = forks
+	data.Starred = starred
+	data.Comments = nil
+	data.Files = nil
+
+	for i, file := range snippet.Files {
+		view := snippetFileView{SnippetFile: file, Index: i}
+
+		// the lines of encrypted files only exist in the browser, so they aren't numbered and can't have comments
+		if !snippet.Encrypted {
+			for n, text := range snippetLines(file.Content) {
+				view.Lines = append(view.Lines, snippetLine{Number: n + 1, Text: text})
+			}
+		}
+
+		data.Files = append(data.Files, view)
+	}
+
+	for _, comment := range models.Threads(comments) {
+		// the range was checked against the content when the comment was posted, and the content never changes, but a broken row shouldn't be able to crash the page, so those end up with the comments about the whole snippet
+		if !comment.Anchored() || comment.File >= len(data.Files) || comment.LineEnd > len(data.Files[comment.File].Lines) {
+			data.Comments = append(data.Comments, comment)
+			continue
 		}
 
+		file := &data.Files[comment.File]
+		file.Annotations = append(file.Annotations, comment)
+		file.Lines[comment.LineEnd-1].Annotations = append(file.Lines[comment.LineEnd-1].Annotations, comment)
+	}
+
+	app.render(w, r, status, "view.tmpl.html", app.newTemplateData(r, data))
+}
+
+// snippetLines splits the content of a file in the lines that are numbered on the view page and that comments can be anchored to
+func snippetLines(content string) []string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.TrimSuffix(content, "\n")
+
+	return strings.Split(content, "\n")
+}
+
+// tagView lists the snippets with a tag. Several tags can be combined in the URL: /tag/go,sql shows snippets tagged go OR sql, and /tag/go+sql shows snippets tagged go AND sql.
+func (app *application) tagView(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	match := models.MatchAny
+	separator := ","
+	if strings.Contains(name, "+") {
+		match = models.MatchAll
+		separator = "+"
+	}
+
+	tags := models.ParseTags(strings.ReplaceAll(name, separator, ","))
+	if len(tags) == 0 || !validator.MaxItems(tags, 10) || !validator.AllMatch(tags, validator.TagRX) {
+		http.NotFound(w, r)
+		return
+	}
+
+	snippets, err := app.snippets.ByTags(r.Context(), tags, match)
+	if err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 
-	data := app.newTemplateData(r, snippetViewTemplateData{
-		Snippet: snippet,
+	counts, err := app.tags.Counts(r.Context(), 50)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r, tagTemplateData{
+		Tags:     tags,
+		MatchAll: match == models.MatchAll,
+		Snippets: snippets,
+		Counts:   counts,
 	})
 
-	app.render(w, r, http.StatusOK, "view.tmpl.html", data)
+	app.render(w, r, http.StatusOK, "tag.tmpl.html", data)
 }
 
 func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r, snippetCreateTemplateData{
+		Files:   []snippetFileForm{{Language: models.LanguageText}},
 		Expires: 1,
 	})
 	app.render(w, r, http.StatusOK, "create.tmpl.html", data)
 }
 
+// snippetFork opens the create form pre-filled with a copy of another snippet. Saving it creates a new snippet owned by the current user that remembers where it came from, the original is never touched.
+func (app *application) snippetFork(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	original, ok := app.viewableSnippet(w, r, id)
+	if !ok {
+		return
+	}
+
+	// the server only has the ciphertext, there is nothing it could fill the form with
+	if original.Encrypted {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var files []snippetFileForm
+	for _, file := range original.Files {
+		files = append(files, snippetFileForm{Name: file.Name, Language: file.Language, Content: file.Content})
+	}
+
+	data := app.newTemplateData(r, snippetCreateTemplateData{
+		Title:        original.Title,
+		Files:        files,
+		Tags:         strings.Join(original.Tags, ", "),
+		Private:      original.Private,
+		Expires:      7,
+		ForkedFromID: original.ID,
+	})
+	app.render(w, r, http.StatusOK, "create.tmpl.html", data)
+}
+
+// viewableSnippet loads a snippet the current user is allowed to see. Private snippets get the same 404 as missing ones, so their IDs can't be probed. It writes the error response itself and returns false when the handler should stop.
+func (app *application) viewableSnippet(w http.ResponseWriter, r *http.Request, id int) (models.Snippet, bool) {
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+
+		return models.Snippet{}, false
+	}
+
+	allowed, err := app.canViewSnippet(r, snippet)
+	if err != nil {
+		app.serverError(w, r, err)
+		return models.Snippet{}, false
+	}
+
+	if !allowed {
+		http.NotFound(w, r)
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
 func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
 
 	// we'll pass this to the decoder to populate the fields
@@ -65,18 +269,28 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 
 	err := app.decodePostForm(r, &templateData)
 	if err != nil {
+		// limitBody only stops the read, the error surfaces here
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			app.clientError(w, http.StatusRequestEntityTooLarge)
+			return
+		}
+
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	templateData.CheckField(validator.NotBlank(templateData.Title), "title", "This field cannot be blank")
-	templateData.CheckField(validator.MaxChars(templateData.Title, 100), "title", "This field cannot be more than 100 characters long")
+	// uploaded files become rows of the form, after a failed validation they are displayed in the form like the others, so nothing has to be uploaded again
+	app.readUploads(r, &templateData)
+
+	templateData.CheckField(validator.NotBlank(templateData.Title), "title", app.t(r, "This field cannot be blank"))
+	templateData.CheckField(validator.MaxChars(templateData.Title, 100), "title", app.t(r, "This field cannot be more than %d characters long", 100))
 
 	/*
 		  Not necessary anymore, the decoder already handles type convertion
 
 			if !validator.NotBlank(rawExpire) {
-				templateData.CheckField(true, "expires", "You must select at least one expiry option")
+				templateData.CheckField(true, "expires", app.t(r, "You must select at least one expiry option"))
 			} else {
 				// PostForm.Get() always returns the form data as a *string*.
 				// However, we're expecting our expires value to be a number, and want to represent it in our Go code as an integer. So we need to manually convert the form data using strconv.Atoi(), and we send a 400 in case that fails
@@ -88,11 +302,55 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 			}
 	*/
 
-	templateData.CheckField(validator.NotBlank(templateData.Content), "content", "This field cannot be blank")
+	// rows that were left completely empty are ignored, that also drops the gaps left by rows removed in the browser
+	templateData.Files = slices.DeleteFunc(templateData.Files, func(file snippetFileForm) bool {
+		return strings.TrimSpace(file.Name) == "" && strings.TrimSpace(file.Content) == ""
+	})
+
+	templateData.CheckField(len(templateData.Files) > 0, "files", app.t(r, "A snippet needs at least one file"))
+	templateData.CheckField(validator.MaxItems(templateData.Files, 20), "files", app.t(r, "A snippet cannot have more than %d files", 20))
+
+	// the names end up as paths in the zip download, so they are kept to a safe set of characters and must be unique
+	names := map[string]bool{}
+	for i, file := range templateData.Files {
+		name := fmt.Sprintf("files.%d.name", i)
+		templateData.CheckField(validator.NotBlank(file.Name), name, app.t(r, "This field cannot be blank"))
+		templateData.CheckField(validator.MaxChars(file.Name, 100), name, app.t(r, "This field cannot be more than %d characters long", 100))
+		templateData.CheckField(validator.Matches(file.Name, validator.FileNameRX) && file.Name != "." && file.Name != "..", name, app.t(r, "File names can only contain letters, numbers, dots, dashes and underscores"))
+		templateData.CheckField(!names[file.Name], name, app.t(r, "Another file already has this name"))
+		names[file.Name] = true
+
+		templateData.CheckField(models.IsLanguage(file.Language), fmt.Sprintf("files.%d.language", i), app.t(r, "This field must be one of the languages in the list"))
+		templateData.CheckField(validator.NotBlank(file.Content), fmt.Sprintf("files.%d.content", i), app.t(r, "This field cannot be blank"))
+
+		// the server can't encrypt anything, the key must never reach it, so content that isn't ciphertext means the browser didn't run main.js
+		if templateData.Encrypted && validator.NotBlank(file.Content) {
+			templateData.CheckField(validator.Matches(file.Content, validator.CiphertextRX), fmt.Sprintf("files.%d.content", i), app.t(r, "Encryption happens in your browser and needs JavaScript enabled"))
+		}
+	}
 
-	templateData.CheckField(validator.PermittedValue(templateData.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	tags := models.ParseTags(templateData.Tags)
+	templateData.CheckField(validator.MaxItems(tags, 10), "tags", app.t(r, "This field cannot have more than %d tags", 10))
+	templateData.CheckField(validator.AllMatch(tags, validator.TagRX), "tags", app.t(r, "Tags can only contain lower case letters, numbers and dashes, up to 32 characters each"))
+
+	templateData.CheckField(validator.PermittedValue(templateData.Expires, 1, 7, 365), "expires", app.t(r, "This field must equal 1, 7 or 365"))
+
+	if templateData.ForkedFromID != 0 {
+		_, ok := app.viewableSnippet(w, r, templateData.ForkedFromID)
+		if !ok {
+			return
+		}
+	}
+
+	// the scan runs last, so the warnings are about the content as it will be posted
+	app.scanFiles(r, &templateData)
+
+	if !templateData.Valid() || (len(templateData.Warnings) > 0 && !templateData.Confirmed) {
+		// always give the form a row to type in
+		if len(templateData.Files) == 0 {
+			templateData.Files = []snippetFileForm{{Language: models.LanguageText}}
+		}
 
-	if !templateData.Valid() {
 		data := app.newTemplateData(r, templateData)
 
 		app.render(w, r, http.StatusUnprocessableEntity, "create.tmpl.html", data)
@@ -100,17 +358,105 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	id, err := app.snippets.Insert(templateData.Title, templateData.Content, time.Now().AddDate(0, 0, templateData.Expires))
+	var files []models.SnippetFile
+	for _, file := range templateData.Files {
+		files = append(files, models.SnippetFile{Name: file.Name, Language: file.Language, Content: file.Content})
+	}
+
+	id, err := app.snippets.Insert(r.Context(), models.Snippet{
+		UserID:       app.authenticatedUserID(r),
+		Title:        templateData.Title,
+		Files:        files,
+		Tags:         tags,
+		Private:      templateData.Private,
+		Encrypted:    templateData.Encrypted,
+		ForkedFromID: templateData.ForkedFromID,
+		Expires:      time.Now().AddDate(0, 0, templateData.Expires),
+	})
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+	app.audit(r, models.AuditSnippetCreate, app.authenticatedUserID(r), id)
+
+	app.sessionManager.Put(r.Context(), "flash", app.t(r, "Snippet successfully created!"))
 
 	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
 }
 
+// snippetPreviewPost renders the markdown sent by the live preview on the create page. It goes through the exact same renderer and sanitizer as the view page, so what you see in the preview is what you get.
+func (app *application) snippetPreviewPost(w http.ResponseWriter, r *http.Request) {
+	var form snippetPreviewForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	html, err := markdown.Render(form.Content)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(html))
+}
+
+// snippetDownload sends the files of a snippet as a zip archive. Like render, the archive is built in a buffer first, so an error can still be sent as a 500 instead of a broken download.
+func (app *application) snippetDownload(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	snippet, ok := app.viewableSnippet(w, r, id)
+	if !ok {
+		return
+	}
+
+	// an archive of ciphertext is of no use to anyone
+	if snippet.Encrypted {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	buff := new(bytes.Buffer)
+	archive := zip.NewWriter(buff)
+
+	for _, file := range snippet.Files {
+		// file names were validated on the create form, so they are safe to use as paths
+		writer, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     file.Name,
+			Method:   zip.Deflate,
+			Modified: snippet.Created,
+		})
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		_, err = writer.Write([]byte(file.Content))
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	err = archive.Close()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="snippet-%d.zip"`, snippet.ID))
+	buff.WriteTo(w)
+}
+
 func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r, userSignupTemplateData{})
 	app.render(w, r, http.StatusOK, "signup.tmpl.html", data)
@@ -125,11 +471,11 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	templateData.CheckField(validator.NotBlank(templateData.Name), "name", "This field cannot be blank")
-	templateData.CheckField(validator.NotBlank(templateData.Email), "email", "This field cannot be blank")
-	templateData.CheckField(validator.Matches(templateData.Email, validator.EmailRX), "email", "This field must be a valid email")
-	templateData.CheckField(validator.NotBlank(templateData.Password), "password", "This field cannot be blank")
-	templateData.CheckField(validator.MinChars(templateData.Password, 8), "password", "This field must be at least 8 characters")
+	templateData.CheckField(validator.NotBlank(templateData.Name), "name", app.t(r, "This field cannot be blank"))
+	templateData.CheckField(validator.NotBlank(templateData.Email), "email", app.t(r, "This field cannot be blank"))
+	templateData.CheckField(validator.Matches(templateData.Email, validator.EmailRX), "email", app.t(r, "This field must be a valid email"))
+	templateData.CheckField(validator.NotBlank(templateData.Password), "password", app.t(r, "This field cannot be blank"))
+	templateData.CheckField(validator.MinChars(templateData.Password, 8), "password", app.t(r, "This field must be at least %d characters", 8))
 
 	if !templateData.Valid() {
 		data := app.newTemplateData(r, templateData)
@@ -139,10 +485,10 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = app.users.Insert(templateData.Name, templateData.Email, templateData.Password)
+	userID, err := app.users.Insert(r.Context(), templateData.Name, templateData.Email, templateData.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrDuplicateEmail) {
-			templateData.AddFormError("email", "Email address already in use")
+			templateData.AddFormError("email", app.t(r, "Email address already in use"))
 
 			data := app.newTemplateData(r, templateData)
 
@@ -154,7 +500,9 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Please log in.")
+	app.audit(r, models.AuditSignup, userID, 0)
+
+	app.sessionManager.Put(r.Context(), "flash", app.t(r, "Your signup was successful. Please log in."))
 
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
@@ -173,9 +521,9 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	templateData.CheckField(validator.NotBlank(templateData.Email), "email", "This field cannot be blank")
-	templateData.CheckField(validator.Matches(templateData.Email, validator.EmailRX), "email", "This field must be a valid email")
-	templateData.CheckField(validator.NotBlank(templateData.Password), "password", "This field cannot be blank")
+	templateData.CheckField(validator.NotBlank(templateData.Email), "email", app.t(r, "This field cannot be blank"))
+	templateData.CheckField(validator.Matches(templateData.Email, validator.EmailRX), "email", app.t(r, "This field must be a valid email"))
+	templateData.CheckField(validator.NotBlank(templateData.Password), "password", app.t(r, "This field cannot be blank"))
 
 	if !templateData.Valid() {
 		data := app.newTemplateData(r, templateData)
@@ -183,12 +531,18 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, err := app.users.Authenticate(templateData.Email, templateData.Password)
+	id, err := app.users.Authenticate(r.Context(), templateData.Email, templateData.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredentials) {
-			templateData.AddNonFieldError("Email or password is incorrect")
+			app.auditLoginFailure(r, templateData.Email)
+			templateData.AddNonFieldError(app.t(r, "Email or password is incorrect"))
 			data := app.newTemplateData(r, templateData)
 			app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl.html", data)
+		} else if errors.Is(err, models.ErrBanned) {
+			app.auditLoginFailure(r, templateData.Email)
+			templateData.AddNonFieldError(app.t(r, "This account has been banned"))
+			data := app.newTemplateData(r, templateData)
+			app.render(w, r, http.StatusForbidden, "login.tmpl.html", data)
 		} else {
 			app.serverError(w, r, err)
 		}
@@ -209,19 +563,48 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 	// 'logged in'.
 	app.sessionManager.Put(r.Context(), authenticatedUserIDSessionKey, id)
 
+	// every remembered login gets its own series, so each device can be logged out on its own
+	var rememberSeries string
+	if templateData.RememberMe {
+		rememberSeries, err = app.rememberUser(w, r, id)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	// so the session shows up on the account page, and can be revoked from there
+	err = app.startUserSession(r, id, rememberSeries)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, models.AuditLogin, id, 0)
+
 	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
 }
 
 func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
-	err := app.sessionManager.RenewToken(r.Context())
-	if err != nil {
+	// read before the session forgets who the user is
+	userID := app.authenticatedUserID(r)
+
+	// ErrNoRecord is fine, sessions started before they were tracked don't have a row, and logging out still has to work for them
+	err := app.userSessions.Delete(r.Context(), app.sessionManager.GetString(r.Context(), userSessionIDSessionKey), userID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
 		app.serverError(w, r, err)
 		return
 	}
 
-	app.sessionManager.Remove(r.Context(), authenticatedUserIDSessionKey)
+	app.audit(r, models.AuditLogout, userID, 0)
+
+	err = app.endSession(w, r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 
-	app.sessionManager.Put(r.Context(), "flash", "You logged out successfully")
+	app.sessionManager.Put(r.Context(), "flash", app.t(r, "You logged out successfully"))
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
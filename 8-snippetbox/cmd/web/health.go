@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+/*
+  These endpoints are meant for machines (load balancers, kubernetes probes, deploy scripts), not people. That's why they are registered straight on the mux without the session and CSRF middleware: a probe doesn't carry cookies, and we don't want every probe to create a row in the sessions table.
+
+  - /healthz answers "is the process alive?" and never touches the database. If this fails the process should be restarted.
+  - /readyz answers "can this instance serve traffic?" and checks its dependencies. If this fails the instance should be taken out of rotation, but not restarted.
+  - /version tells us exactly what build is running.
+*/
+
+// How long the readiness probe waits on the database before giving up, this should be lower than the probe timeout configured on the load balancer.
+const readinessTimeout = 2 * time.Second
+
+type readinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+type versionResponse struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"goVersion"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified"`
+}
+
+func (app *application) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok"))
+}
+
+func (app *application) readyz(w http.ResponseWriter, r *http.Request) {
+	response := readinessResponse{
+		Status: "ok",
+		Checks: map[string]string{
+			"database":   "ok",
+			"migrations": "ok",
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	err := app.db.Ping(ctx)
+	if err != nil {
+		app.logger.WarnContext(r.Context(), "readiness check failed", "check", "database", "error", err.Error())
+		response.Checks["database"] = "unreachable"
+		response.Checks["migrations"] = "unknown"
+	} else {
+		pending, err := app.migrations.Pending(ctx)
+		if err != nil {
+			app.logger.WarnContext(r.Context(), "readiness check failed", "check", "migrations", "error", err.Error())
+			response.Checks["migrations"] = "unknown"
+		} else if len(pending) > 0 {
+			response.Checks["migrations"] = fmt.Sprintf("pending %v", pending)
+		}
+	}
+
+	status := http.StatusOK
+	for _, check := range response.Checks {
+		if check != "ok" {
+			response.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	app.writeJSON(w, r, status, response)
+}
+
+func (app *application) version(w http.ResponseWriter, r *http.Request) {
+	app.writeJSON(w, r, http.StatusOK, readVersion())
+}
+
+// readVersion collects the build info embedded by the go tool, VCS information is only available when building from inside a git checkout with "go build" (not "go run").
+func readVersion() versionResponse {
+	response := versionResponse{Version: "unknown"}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return response
+	}
+
+	response.Version = info.Main.Version
+	response.GoVersion = info.GoVersion
+
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			response.Revision = setting.Value
+		case "vcs.time":
+			response.Time = setting.Value
+		case "vcs.modified":
+			response.Modified = setting.Value == "true"
+		}
+	}
+
+	return response
+}
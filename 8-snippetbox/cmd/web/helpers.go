@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -11,26 +12,41 @@ import (
 
 	"github.com/go-playground/form/v4"
 	"github.com/justinas/nosurf"
+	"go.opentelemetry.io/otel/codes"
 )
 
 type rootTemplateData struct {
-	CurrentYear     int
-	FlashMessage    string
-	PageData        any
-	IsAuthenticated bool
-	CsrfToken       string
+	CurrentYear         int
+	FlashMessage        string
+	PageData            any
+	IsAuthenticated     bool
+	IsModerator         bool
+	AuthenticatedUserID int
+	CsrfToken           string
+	// For the nonce attribute of every <script>, see csp.go
+	CSPNonce string
+	// The code of the locale the page is in, for the lang attribute
+	Locale string
+	// Dates are displayed in this time zone, see timezone.go
+	TimeZone *time.Location
 }
 
 // The serverError helper writes a log entry at Error level (including the request method and URI as attributes), then sends a generic 500 Internal Server Error response to the user.
+// The response includes the request ID, which is also in the log entry, so a user reporting the error gives us everything we need to find it.
 func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
 	method := r.Method
 	uri := r.URL.RequestURI()
 	trace := string(debug.Stack())
 
-	app.logger.Error(err.Error(), "method", method, "uri", uri, "trace", trace)
+	app.logger.ErrorContext(r.Context(), err.Error(), "method", method, "uri", uri, "trace", trace)
 
 	// http.StatusText returns a human friendly text representation of the http code, like 400 would be "bad request"
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	message := http.StatusText(http.StatusInternalServerError)
+	if id, ok := r.Context().Value(requestIDContextKey).(string); ok {
+		message = fmt.Sprintf("%s\n\nIf you report this problem, please include the request ID: %s", message, id)
+	}
+
+	http.Error(w, message, http.StatusInternalServerError)
 }
 
 // The clientError helper sends a specific status code and corresponding description to the user. We use this to send responses like 400 "Bad Request" when there's a problem with the request that the user sent.
@@ -39,8 +55,11 @@ func (app *application) clientError(w http.ResponseWriter, status int) {
 }
 
 func (app *application) render(w http.ResponseWriter, r *http.Request, status int, page string, data rootTemplateData) {
+	// rendering gets its own span, so a slow page can be told apart from a slow query
+	_, span := app.tracer.Start(r.Context(), "render "+page)
+	defer span.End()
 
-	ts, ok := app.templateCache[page]
+	ts, ok := app.templateCache[app.locale(r).Code()][page]
 	if !ok {
 		err := fmt.Errorf("the template %s does not exist", page)
 		app.serverError(w, r, err)
@@ -53,6 +72,8 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, status in
 	// write to buffer instead of the response
 	err := ts.ExecuteTemplate(buff, "root", data)
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		app.serverError(w, r, err)
 		return
 	}
@@ -60,6 +81,9 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, status in
 	/*
 	  If you don’t call w.WriteHeader() explicitly, then the first call to w.Write() will automatically send a 200 status code to the user. So, if you want to send a non-200 status code, you must call w.WriteHeader() before any call to w.Write().
 	*/
+	// the language of the page depends on this header, caches in between have to keep one copy per language
+	w.Header().Add("Vary", "Accept-Language")
+
 	// okay, now that we are clear of template errors, we write the status
 	w.WriteHeader(status)
 
@@ -67,13 +91,33 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, status in
 	buff.WriteTo(w)
 }
 
+// The writeJSON helper encodes data into a buffer first, for the same reason render does: if encoding fails we can still send a proper 500 instead of half a response.
+func (app *application) writeJSON(w http.ResponseWriter, r *http.Request, status int, data any) {
+	buff := new(bytes.Buffer)
+
+	err := json.NewEncoder(buff).Encode(data)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	buff.WriteTo(w)
+}
+
 func (app *application) newTemplateData(r *http.Request, x any) rootTemplateData {
 	return rootTemplateData{
-		CurrentYear:     time.Now().Year(),
-		FlashMessage:    app.sessionManager.PopString(r.Context(), "flash"),
-		PageData:        x,
-		IsAuthenticated: app.isAuthenticated(r),
-		CsrfToken:       nosurf.Token(r),
+		CurrentYear:         time.Now().Year(),
+		FlashMessage:        app.sessionManager.PopString(r.Context(), "flash"),
+		PageData:            x,
+		IsAuthenticated:     app.isAuthenticated(r),
+		IsModerator:         app.isModerator(r),
+		AuthenticatedUserID: app.authenticatedUserID(r),
+		CsrfToken:           nosurf.Token(r),
+		CSPNonce:            cspNonce(r),
+		Locale:              app.locale(r).Code(),
+		TimeZone:            app.timeZone(r),
 	}
 }
 
@@ -102,7 +146,15 @@ func (app *application) decodePostForm(r *http.Request, destination any) error {
 
 	/*
 	  Chapter 7.2 has more information on how to use different types  of data with PostForm.Get(), like multiple checkboxes and multipart form data
+
+	  ParseForm ignores multipart bodies, the forms that upload files need ParseMultipartForm, which also adds the values of the text fields to r.PostForm. On the create form the parseMultipartForm middleware did that already, with its size limits and before noSurf could, so this call returns straight away there and is only a fallback for multipart bodies sent anywhere else.
 	*/
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		err = r.ParseMultipartForm(multipartMaxMemory)
+		if err != nil {
+			return err
+		}
+	}
 
 	err = app.formDecoder.Decode(destination, r.PostForm)
 	if err != nil {
@@ -129,3 +181,26 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 
 	return isAuthenticated
 }
+
+func (app *application) isModerator(r *http.Request) bool {
+	isModerator, ok := r.Context().Value(isModeratorContextKey).(bool)
+	if !ok {
+		return false
+	}
+
+	return isModerator
+}
+
+// How much of the User-Agent header is stored, the columns are VARCHAR(512)
+const maxUserAgentBytes = 512
+
+// userAgent returns the User-Agent header of the request, cut to fit in the database
+func userAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentBytes {
+		// cutting at a byte count can split a character in two, the broken half is dropped
+		ua = strings.ToValidUTF8(ua[:maxUserAgentBytes], "")
+	}
+
+	return ua
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/i18n"
+)
+
+/*
+Every page is in the locale the user picked on the account page, or when they didn't pick one (or aren't logged in) in the best match for the Accept-Language header of their browser, see i18n.Catalog.Match.
+
+Templates translate with the "t" and "n" functions. Messages made in handlers, like validation errors and flash messages, are translated with app.t before they are stored, they are displayed as they are.
+*/
+
+// locale returns the locale of the current request
+func (app *application) locale(r *http.Request) *i18n.Locale {
+	preference, _ := r.Context().Value(localePreferenceContextKey).(string)
+
+	return app.catalog.Match(preference, r.Header.Get("Accept-Language"))
+}
+
+// t translates a message to the locale of the current request, see i18n.Locale.T
+func (app *application) t(r *http.Request, key string, args ...any) string {
+	return app.locale(r).T(key, args...)
+}
+
+// accountLocalePost saves the locale the user picked on the account page
+func (app *application) accountLocalePost(w http.ResponseWriter, r *http.Request) {
+	var form localeForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// the select only offers the locales we have, anything else was made up
+	if _, ok := app.catalog.Get(form.Locale); form.Locale != "" && !ok {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.users.SetLocale(r.Context(), app.authenticatedUserID(r), form.Locale)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// in the new language already, it's what the next page will be in
+	locale := app.catalog.Match(form.Locale, r.Header.Get("Accept-Language"))
+	app.sessionManager.Put(r.Context(), "flash", locale.T("Language saved"))
+
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
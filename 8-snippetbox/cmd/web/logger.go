@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+/*
+slog lets us wrap a Handler to enrich every record before it gets written. We use it to pull the request ID out of the context, so any call like app.logger.ErrorContext(r.Context(), ...) is automatically tagged with the request (and trace) it belongs to, without having to pass the ID around by hand.
+
+Important: only the *Context variants (InfoContext, ErrorContext, ...) hand the context to the handler. A plain app.logger.Info() call gets context.Background() and won't carry a request ID.
+*/
+type contextHandler struct {
+	slog.Handler
+}
+
+func newContextHandler(h slog.Handler) *contextHandler {
+	return &contextHandler{Handler: h}
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id, ok := ctx.Value(requestIDContextKey).(string); ok {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+
+	// with tracing enabled we also add the trace ID, so we can jump from a log line straight to the trace
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(slog.String("trace_id", spanContext.TraceID().String()))
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs and WithGroup must be overwritten too, otherwise logger.With() would return the embedded handler and we would lose the request ID on derived loggers.
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
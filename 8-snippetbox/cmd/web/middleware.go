@@ -2,11 +2,26 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/justinas/nosurf"
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/models"
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/ratelimit"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 /*
@@ -54,13 +69,13 @@ func (m *MiddlewareChain) ThenFunc(h http.HandlerFunc) http.Handler {
   As an example, a common use-case for early returns is authentication middleware which only allows execution of the chain to continue if a particular check is passed.
 */
 
-func commonHeaders(next http.Handler) http.Handler {
+func (app *application) commonHeaders(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		/*
 		  Important: You must make sure that your response header map contains all the headers you want before you call w.WriteHeader() or w.Write(). Any changes you make to the response header map after calling w.WriteHeader() or w.Write() will have no effect on the headers that the user receives.
 		*/
-		w.Header().Set("Content-Security-Policy",
-			"default-src 'self'; style-src 'self' fonts.googleapis.com; font-src fonts.gstatic.com")
+		// the policy comes from the config (-csp) so it can be tightened without a new build, and gets a new nonce for every request
+		app.setCSP(w, r)
 
 		w.Header().Set("Referrer-Policy", "origin-when-cross-origin")
 		w.Header().Set("X-Content-Type-Options", "nosniff")
@@ -73,6 +88,36 @@ func commonHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// Incoming request IDs are only trusted if they look like an ID, anything else could be used to inject junk into our logs
+var requestIDRX = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,128}$`)
+
+// The requestID middleware makes sure every request has an ID. If the client (or a proxy in front of us) already sent an X-Request-ID header we reuse it, so a single ID can be followed across services, otherwise we generate a random one.
+// The ID is stored in the request context for the logger and sent back in the response so users can quote it in bug reports.
+// The Content-Security-Policy nonce is put in the context here too, see setCSP for why it has to happen this early.
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDRX.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+		ctx = context.WithValue(ctx, cspNonceContextKey, newCSPNonce())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+
+	// crypto/rand.Read never returns an error on the platforms we support, see https://pkg.go.dev/crypto/rand#Read
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
 type wrappedWriter struct {
 	http.ResponseWriter
 	statusCode int
@@ -83,6 +128,11 @@ func (w *wrappedWriter) WriteHeader(statusCode int) {
 	w.statusCode = statusCode
 }
 
+// Unwrap lets http.ResponseController reach the writer of the server through ours, without it setting deadlines or flushing fails with http.ErrNotSupported
+func (w *wrappedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var (
@@ -100,7 +150,56 @@ func (app *application) logRequest(next http.Handler) http.Handler {
 
 		next.ServeHTTP(wrapped, r)
 
-		app.logger.Info("Request", "status", wrapped.statusCode, "ip", ip, "proto", proto, "method", method, "uri", uri, "time", time.Since(start))
+		app.logger.InfoContext(r.Context(), "Request", "status", wrapped.statusCode, "ip", ip, "proto", proto, "method", method, "uri", uri, "time", time.Since(start))
+	})
+}
+
+// The traceRequest middleware starts the server span for the request. If the caller sent a W3C traceparent header the span joins their trace, otherwise it starts a new one.
+// When tracing is disabled app.tracer is a no-op and this costs next to nothing.
+func (app *application) traceRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := app.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		// We don't know the route pattern yet, the servemux fills r.Pattern in further down the chain, so we start with the method and rename the span on the way back up
+		ctx, span := app.tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				semconv.UserAgentOriginal(r.UserAgent()),
+				semconv.ClientAddress(r.RemoteAddr),
+			),
+		)
+		defer span.End()
+
+		if id, ok := ctx.Value(requestIDContextKey).(string); ok {
+			span.SetAttributes(attribute.String("request.id", id))
+		}
+
+		wrapped := &wrappedWriter{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+
+		// the middleware between here and the servemux must pass this same request on, not a copy, or r.Pattern below stays empty
+		r = r.WithContext(ctx)
+		next.ServeHTTP(wrapped, r)
+
+		// patterns look like "GET /snippet/view/{id}", which is exactly what we want as a span name: low cardinality but still descriptive
+		if r.Pattern != "" {
+			span.SetName(r.Pattern)
+
+			_, route, found := strings.Cut(r.Pattern, " ")
+			if !found {
+				route = r.Pattern
+			}
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(wrapped.statusCode))
+		if wrapped.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(wrapped.statusCode))
+		}
 	})
 }
 
@@ -121,6 +220,18 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
+// requireModerator only lets moderators through, it has to come after requireAuthentication. Everyone else gets a 404, the moderation pages don't exist for them.
+func (app *application) requireModerator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isModerator(r) {
+			http.NotFound(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// If the user is not authenticated, redirect them to the login page and
@@ -140,6 +251,127 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
+// limitBody caps the size of request bodies at n bytes. Requests that announce a bigger body get a 413 straight away, and http.MaxBytesReader makes reading stop at n bytes for the ones that don't say (or lie about) their size.
+// It has to run before noSurf, which reads the body of POST requests to find the CSRF token.
+func (app *application) limitBody(n int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				app.clientError(w, http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+/*
+extendDeadlines gives requests d to be read and answered, from the moment they reach it, instead of -read-timeout and -write-timeout. Those are server-wide and short on purpose, which is right for forms and pages but cuts off uploads over a slow connection in the middle of the body.
+
+The deadlines are set on the connection through http.ResponseController, so every ResponseWriter wrapped around the one of the server on the way here has to have an Unwrap method. It has to come before anything that reads the body.
+*/
+func (app *application) extendDeadlines(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rc := http.NewResponseController(w)
+			deadline := time.Now().Add(d)
+
+			err := rc.SetReadDeadline(deadline)
+			if err == nil {
+				err = rc.SetWriteDeadline(deadline)
+			}
+			if err != nil {
+				// the request still works with the normal timeouts, as long as it's not too big
+				app.logger.WarnContext(r.Context(), "failed to extend the request deadlines", "error", err.Error())
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+/*
+parseMultipartForm parses multipart bodies up front, keeping at most multipartMaxMemory bytes of them in memory and writing the rest to temporary files, which are removed once the request is done.
+
+It has to run before noSurf. nosurf looks for the CSRF token with r.PostFormValue, and that parses a multipart body nobody parsed yet with the 32 MB default of net/http, so every upload up to the body limit would be held in memory. Once r.MultipartForm is set, later calls to ParseMultipartForm don't parse anything again.
+*/
+func (app *application) parseMultipartForm(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		err := r.ParseMultipartForm(multipartMaxMemory)
+		if err != nil {
+			// limitBody stopped the read, the body announced a smaller size than it has
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				app.clientError(w, http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+/*
+rateLimit refuses requests once their token bucket in limiter is empty (see internal/ratelimit), answering with a 429 Too Many Requests page and a Retry-After header saying how many seconds to wait.
+
+Logged in users are limited by their ID, so they get the same bucket from every device and network, anyone else by their IP address. The name is put in front of the key so different limits never share buckets.
+
+It needs the session, so it has to come after LoadAndSave and authenticate in the chain.
+*/
+func (app *application) rateLimit(name string, limiter ratelimit.Limiter) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := fmt.Sprintf("%s:ip:%s", name, clientIP(r))
+			if id := app.authenticatedUserID(r); id != 0 {
+				key = fmt.Sprintf("%s:user:%d", name, id)
+			}
+
+			ok, retryAfter, err := limiter.Allow(r.Context(), key)
+			if err != nil {
+				// a broken limiter shouldn't take the site down with it, so the request goes through
+				app.logger.WarnContext(r.Context(), "rate limiter failed", "key", key, "error", err.Error())
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !ok {
+				// Retry-After is in whole seconds, rounded up so retrying right on time works
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+				app.render(w, r, http.StatusTooManyRequests, "ratelimited.tmpl.html", app.newTemplateData(r, rateLimitedTemplateData{
+					RetryAfter: time.Duration(seconds) * time.Second,
+				}))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP is the IP address of the other end of the connection, without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
 // Create a NoSurf middleware function which uses a customized CSRF cookie with
 // the Secure, Path and HttpOnly attributes set.
 func (app *application) noSurf(next http.Handler) http.Handler {
@@ -160,14 +392,25 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		// "authenticatedUserID" value is in the session -- in which case we
 		// call the next handler in the chain as normal and return.
 		id := app.sessionManager.GetInt(r.Context(), authenticatedUserIDSessionKey)
+
+		// no session, but maybe the user asked us to remember them, see remember.go
+		if id == 0 {
+			var err error
+			id, err = app.rememberedUser(w, r)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+		}
+
 		if id == 0 {
 			next.ServeHTTP(w, r)
 			return
 		}
 
 		// Otherwise, we check to see if a user with that ID exists in our database.
-		exists, err := app.users.Exists(id)
-		if err != nil {
+		user, err := app.users.Get(r.Context(), id)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
 			app.serverError(w, r, err)
 			return
 		}
@@ -176,11 +419,33 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		// coming from an authenticated user who exists in our database. We
 		// create a new copy of the request (with an isAuthenticatedContextKey
 		// value of true in the request context) and assign it to r.
-		if exists {
-			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
-			r = r.WithContext(ctx)
+		// Banned users keep their session, but it doesn't log them in anymore.
+		if err != nil || user.Banned {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Sessions revoked from the account page are logged out for good, see sessions.go
+		active, err := app.activeUserSession(r, id)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
 		}
 
+		if !active {
+			app.sessionManager.Remove(r.Context(), authenticatedUserIDSessionKey)
+			app.sessionManager.Remove(r.Context(), userSessionIDSessionKey)
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+		ctx = context.WithValue(ctx, isModeratorContextKey, user.Moderator)
+		ctx = context.WithValue(ctx, localePreferenceContextKey, user.Locale)
+		ctx = context.WithValue(ctx, timeZonePreferenceContextKey, user.TimeZone)
+		r = r.WithContext(ctx)
+
 		next.ServeHTTP(w, r)
 	})
 }
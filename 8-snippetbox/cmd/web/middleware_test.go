@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/models"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanNamed returns the first span called name, or fails the test
+func spanNamed(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+
+	names := make([]string, len(spans))
+	for i, span := range spans {
+		names[i] = span.Name
+	}
+	t.Fatalf("no span named %q, got %q", name, names)
+
+	return tracetest.SpanStub{}
+}
+
+// stringAttribute returns the value of the attribute key of span, "" when it doesn't have it
+func stringAttribute(span tracetest.SpanStub, key string) string {
+	for _, attribute := range span.Attributes {
+		if string(attribute.Key) == key {
+			return attribute.Value.Emit()
+		}
+	}
+
+	return ""
+}
+
+/*
+The server span is renamed after the route once the servemux matched one. Any middleware between traceRequest and the servemux that passes on a copy of the request breaks that, the servemux sets r.Pattern on the copy, so this goes through the full routes with every middleware.
+*/
+func TestTraceRequest(t *testing.T) {
+	app, spans := newTestApplication(t)
+
+	rr := get(app, "/user/login")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	ended := spans.ended(t)
+
+	server := spanNamed(t, ended, "GET /user/login")
+	if server.SpanKind != trace.SpanKindServer {
+		t.Errorf("got span kind %s, want %s", server.SpanKind, trace.SpanKindServer)
+	}
+	if route := stringAttribute(server, string(semconv.HTTPRouteKey)); route != "/user/login" {
+		t.Errorf("got %s %q, want %q", semconv.HTTPRouteKey, route, "/user/login")
+	}
+	if status := stringAttribute(server, string(semconv.HTTPResponseStatusCodeKey)); status != "200" {
+		t.Errorf("got %s %q, want %q", semconv.HTTPResponseStatusCodeKey, status, "200")
+	}
+
+	render := spanNamed(t, ended, "render login.tmpl.html")
+	if render.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Errorf("the render span is not a child of the server span")
+	}
+}
+
+// A traceparent header from the caller puts our spans in their trace
+func TestTraceRequestJoinsTrace(t *testing.T) {
+	app, spans := newTestApplication(t)
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	r := httptest.NewRequest(http.MethodGet, "/user/login", nil)
+	r.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+
+	rr := serve(app, r)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	server := spanNamed(t, spans.ended(t), "GET /user/login")
+	if got := server.SpanContext.TraceID().String(); got != traceID {
+		t.Errorf("got trace ID %s, want %s", got, traceID)
+	}
+}
+
+// The queries of a request are children of its server span. Needs a database, see newTestDB.
+func TestTraceRequestQueries(t *testing.T) {
+	app, spans := newTestApplication(t)
+
+	app.db = newTestDB(t, spans)
+	app.migrations = &models.MigrationModel{DB: app.db}
+
+	get(app, "/readyz")
+
+	ended := spans.ended(t)
+	server := spanNamed(t, ended, "GET /readyz")
+
+	// Pending runs a SELECT, which the query tracer names after its operation
+	query := spanNamed(t, ended, "SELECT")
+	if query.SpanContext.TraceID() != server.SpanContext.TraceID() {
+		t.Errorf("the query span is not in the trace of the request")
+	}
+	if query.SpanKind != trace.SpanKindClient {
+		t.Errorf("got span kind %s, want %s", query.SpanKind, trace.SpanKindClient)
+	}
+}
+
+// The deadlines can only be set through the ResponseWriters the standard middleware wraps around the one of the server, which needs them to have an Unwrap method
+func TestExtendDeadlines(t *testing.T) {
+	app, _ := newTestApplication(t)
+
+	var logs bytes.Buffer
+	app.logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	chain := MiddlewareChain{}
+	chain.Append(requestID, app.traceRequest, app.recoverPanic, app.logRequest, app.commonHeaders, app.extendDeadlines(time.Minute))
+
+	srv := httptest.NewServer(chain.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	if strings.Contains(logs.String(), "failed to extend") {
+		t.Errorf("the deadlines were not extended: %s", logs.String())
+	}
+}
+
+func TestParseMultipartForm(t *testing.T) {
+	app, _ := newTestApplication(t)
+
+	newBody := func(content string) (*bytes.Buffer, string) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("title", "uploaded")
+		fw, _ := mw.CreateFormFile("uploads", "main.go")
+		io.WriteString(fw, content)
+		mw.Close()
+
+		return &body, mw.FormDataContentType()
+	}
+
+	tests := []struct {
+		name        string
+		content     string
+		wantStatus  int
+		wantUploads int
+	}{
+		{"Parsed", "package main", http.StatusNoContent, 1},
+		// bigger than the limit below, sent without a Content-Length so limitBody has to stop the read
+		{"Too large", strings.Repeat("a", 2048), http.StatusRequestEntityTooLarge, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var uploads int
+
+			chain := MiddlewareChain{}
+			chain.Append(app.limitBody(1024), app.parseMultipartForm)
+			handler := chain.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+				// what noSurf does to find the token, it must not parse the body again
+				r.PostFormValue("csrf_token")
+				uploads = len(r.MultipartForm.File["uploads"])
+				w.WriteHeader(http.StatusNoContent)
+			})
+
+			body, contentType := newBody(tt.content)
+			r := httptest.NewRequest(http.MethodPost, "/snippet/create", io.NopCloser(body))
+			r.Header.Set("Content-Type", contentType)
+			r.ContentLength = -1
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if uploads != tt.wantUploads {
+				t.Errorf("got %d uploads, want %d", uploads, tt.wantUploads)
+			}
+		})
+	}
+}
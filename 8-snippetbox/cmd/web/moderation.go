@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/models"
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/validator"
+)
+
+// snippetReportPost files a report about a snippet for the moderators. Anyone who can see a snippet can report it, except its author.
+func (app *application) snippetReportPost(w http.ResponseWriter, r *http.Request) {
+	var form reportForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	snippet, ok := app.viewableSnippet(w, r, form.SnippetID)
+	if !ok {
+		return
+	}
+
+	// the report button isn't shown to the author
+	if snippet.UserID == app.authenticatedUserID(r) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(models.IsReportReason(form.Reason), "reason", app.t(r, "This field must be one of the reasons in the list"))
+	form.CheckField(validator.MaxChars(form.Details, 1000), "details", app.t(r, "This field cannot be more than %d characters long", 1000))
+	if form.Reason == "other" {
+		form.CheckField(validator.NotBlank(form.Details), "details", app.t(r, "Tell us what is wrong with this snippet"))
+	}
+
+	if !form.Valid() {
+		app.renderSnippet(w, r, http.StatusUnprocessableEntity, snippetViewTemplateData{Snippet: snippet, ReportForm: form})
+		return
+	}
+
+	err = app.moderation.Report(r.Context(), snippet.ID, app.authenticatedUserID(r), form.Reason, form.Details)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", app.t(r, "Thanks for the report, a moderator will look at it soon"))
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// moderationQueue lists the open reports, with the latest moderation actions below them. Only moderators get here, see requireModerator.
+func (app *application) moderationQueue(w http.ResponseWriter, r *http.Request) {
+	reports, err := app.moderation.OpenReports(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	log, err := app.moderation.Log(r.Context(), 50)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r, moderationTemplateData{Reports: reports, Log: log})
+	app.render(w, r, http.StatusOK, "moderation.tmpl.html", data)
+}
+
+func (app *application) moderationDismissPost(w http.ResponseWriter, r *http.Request) {
+	app.moderate(w, r, app.moderation.Dismiss, "Report dismissed")
+}
+
+func (app *application) moderationHidePost(w http.ResponseWriter, r *http.Request) {
+	app.moderate(w, r, app.moderation.Hide, "Snippet hidden")
+}
+
+func (app *application) moderationBanPost(w http.ResponseWriter, r *http.Request) {
+	app.moderate(w, r, app.moderation.Ban, "User banned and all their snippets hidden")
+}
+
+// moderate is what the moderation actions have in common: they act on a report and go back to the queue. The models return ErrNoRecord when the report can't be acted on anymore, usually because another moderator got to it first.
+func (app *application) moderate(w http.ResponseWriter, r *http.Request, action func(ctx context.Context, moderatorID, reportID int) error, flash string) {
+	var form moderationForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = action(r.Context(), app.authenticatedUserID(r), form.ReportID)
+	if err != nil {
+		if !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+
+		flash = "Nothing was done, the report was already resolved or its author can't be banned"
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", app.t(r, flash))
+
+	http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/models"
+)
+
+/*
+"Remember me" keeps a user logged in for config.RememberLifetime, which is a lot longer than a session lasts. It doesn't make the session itself longer: the cookie below is only used when there is no logged in session, and then it starts a new one, so the session lifetime and idle timeout still apply to every session.
+
+The cookie holds "series.token", see models.RememberModel for how they are checked and rotated.
+*/
+const rememberCookieName = "remember_me"
+
+// rememberUser starts a persistent login for userID and sends its cookie, it returns the series for startUserSession
+func (app *application) rememberUser(w http.ResponseWriter, r *http.Request, userID int) (string, error) {
+	series, token, err := app.remember.Create(r.Context(), userID, app.config.RememberLifetime)
+	if err != nil {
+		return "", err
+	}
+
+	app.setRememberCookie(w, series, token)
+
+	return series, nil
+}
+
+func (app *application) setRememberCookie(w http.ResponseWriter, series, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:  rememberCookieName,
+		Value: series + "." + token,
+		Path:  "/",
+		// the database decides when the login expires, the cookie only has to live at least as long
+		MaxAge: int(app.config.RememberLifetime.Seconds()),
+		// like the session cookie, JavaScript can't read it and it's only sent over HTTPS
+		HttpOnly: true,
+		Secure:   true,
+		// Lax and not Strict, following a link to the site from somewhere else should still log you in
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (app *application) clearRememberCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     rememberCookieName,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+/*
+rememberedUser logs in the user of the "remember me" cookie, if there is one, and returns their ID. It returns 0 when there is no cookie or it doesn't log anyone in anymore, and clears the cookie in that case so we don't look it up on every request.
+
+A cookie with a token that was already used means it was copied, the model has logged out every session of the user by then. That is worth a warning in the logs, and an event on the account page so the user knows why they have to log in again.
+*/
+func (app *application) rememberedUser(w http.ResponseWriter, r *http.Request) (int, error) {
+	cookie, err := r.Cookie(rememberCookieName)
+	if err != nil {
+		return 0, nil
+	}
+
+	series, token, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		app.clearRememberCookie(w)
+		return 0, nil
+	}
+
+	userID, nextToken, err := app.remember.Use(r.Context(), series, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNoRecord):
+			app.clearRememberCookie(w)
+			return 0, nil
+		case errors.Is(err, models.ErrStolenToken):
+			app.clearRememberCookie(w)
+			app.logger.WarnContext(r.Context(), "remember me token reused, logged out every session of the user", "user_id", userID, "ip", clientIP(r))
+			app.audit(r, models.AuditRememberTheft, userID, 0)
+			return 0, nil
+		default:
+			return 0, err
+		}
+	}
+
+	// empty when the browser already got the next token from a request sent at the same time
+	if nextToken != "" {
+		app.setRememberCookie(w, series, nextToken)
+	}
+
+	// the same as logging in with a password, see userLoginPost
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return 0, err
+	}
+
+	app.sessionManager.Put(r.Context(), authenticatedUserIDSessionKey, userID)
+
+	err = app.startUserSession(r, userID, series)
+	if err != nil {
+		return 0, err
+	}
+
+	app.audit(r, models.AuditRememberLogin, userID, 0)
+
+	return userID, nil
+}
@@ -17,6 +17,18 @@ func (app *application) routes() http.Handler {
 	*/
 	mux.Handle("GET /static/", http.StripPrefix("/static", noIndexing(staticFileServer)))
 
+	// Probes and build info, these are deliberately outside of the dynamic stack so they don't load sessions or require a CSRF token
+	mux.HandleFunc("GET /healthz", app.healthz)
+	mux.HandleFunc("GET /readyz", app.readyz)
+	mux.HandleFunc("GET /version", app.version)
+
+	// Feed readers don't log in, the feeds are public and answer conditional requests without sessions, see feeds.go
+	mux.HandleFunc("GET /feed.atom", app.feed)
+	mux.HandleFunc("GET /user/{id}/feed.atom", app.userFeed)
+
+	// Browsers send Content-Security-Policy violations here, without cookies or a CSRF token, see csp.go
+	mux.Handle("POST /csp-report", app.limitBody(maxCSPReportBytes)(http.HandlerFunc(app.cspReportPost)))
+
 	// Middleware stack for our main pages
 	dynamicStack := MiddlewareChain{}
 	dynamicStack.Append(app.sessionManager.LoadAndSave, app.noSurf, app.authenticate)
@@ -28,6 +40,21 @@ func (app *application) routes() http.Handler {
 	protectedStack.Append(dynamicStack.handlers...)
 	protectedStack.Append(app.requireAuthentication)
 
+	// Moderation pages, requireModerator needs requireAuthentication to have run first
+	moderatorStack := MiddlewareChain{}
+	moderatorStack.Append(protectedStack.handlers...)
+	moderatorStack.Append(app.requireModerator)
+
+	// The create form can carry uploaded files, so it gets more time than other requests, and its body is limited and parsed, all before anything in the protected stack reads it
+	uploadStack := MiddlewareChain{}
+	uploadStack.Append(app.extendDeadlines(app.config.UploadTimeout), app.limitBody(maxCreateBodyBytes), app.parseMultipartForm)
+	uploadStack.Append(protectedStack.handlers...)
+
+	// Creating snippets is throttled, the limiter goes last because it needs the session to know who the user is
+	createStack := MiddlewareChain{}
+	createStack.Append(uploadStack.handlers...)
+	createStack.Append(app.rateLimit("snippet-create", app.createLimiter))
+
 	/*
 	  When a route pattern ends with a trailing slash — like "/" or "/static/" — it is known as a subtree path pattern. Subtree path patterns are matched (and the corresponding handler called) whenever the start of a request URL path matches the subtree path.
 
@@ -38,6 +65,8 @@ func (app *application) routes() http.Handler {
 	  To prevent subtree path patterns from acting like they have a wildcard at the end, you can append the spec
 	*/
 	mux.Handle("GET /{$}", dynamicStack.ThenFunc(app.home))
+	mux.Handle("GET /tag/{name}", dynamicStack.ThenFunc(app.tagView))
+	mux.Handle("GET /popular", dynamicStack.ThenFunc(app.popular))
 
 	/*
 	  When a pattern doesn’t have a trailing slash, it will only be matched (and the corresponding handler called) when the request URL path exactly matches the pattern in full.
@@ -50,22 +79,58 @@ func (app *application) routes() http.Handler {
 	// Protected routes - includes session + auth check
 	mux.Handle("GET /snippet/view/{id}", protectedStack.ThenFunc(app.snippetView))
 	mux.Handle("GET /snippet/create", protectedStack.ThenFunc(app.snippetCreate))
-	mux.Handle("POST /snippet/create", protectedStack.ThenFunc(app.snippetCreatePost))
+	mux.Handle("GET /snippet/fork/{id}", protectedStack.ThenFunc(app.snippetFork))
+	mux.Handle("GET /snippet/download/{id}", protectedStack.ThenFunc(app.snippetDownload))
+	mux.Handle("POST /snippet/create", createStack.ThenFunc(app.snippetCreatePost))
+	mux.Handle("POST /snippet/preview", protectedStack.ThenFunc(app.snippetPreviewPost))
+	mux.Handle("POST /snippet/star", protectedStack.ThenFunc(app.snippetStarPost))
+	mux.Handle("POST /snippet/unstar", protectedStack.ThenFunc(app.snippetUnstarPost))
+	mux.Handle("POST /snippet/report", protectedStack.ThenFunc(app.snippetReportPost))
+	mux.Handle("GET /starred", protectedStack.ThenFunc(app.starredList))
 	mux.Handle("POST /user/logout", protectedStack.ThenFunc(app.userLogoutPost))
+	mux.Handle("GET /account", protectedStack.ThenFunc(app.account))
+	mux.Handle("POST /account/sessions/revoke", protectedStack.ThenFunc(app.sessionRevokePost))
+	mux.Handle("POST /account/sessions/revoke-all", protectedStack.ThenFunc(app.logoutEverywherePost))
+	mux.Handle("POST /account/locale", protectedStack.ThenFunc(app.accountLocalePost))
+	mux.Handle("POST /account/time-zone", protectedStack.ThenFunc(app.accountTimeZonePost))
+	mux.Handle("GET /account/webhooks", protectedStack.ThenFunc(app.webhookList))
+	mux.Handle("POST /account/webhooks", protectedStack.ThenFunc(app.webhookCreatePost))
+	mux.Handle("POST /account/webhooks/delete", protectedStack.ThenFunc(app.webhookDeletePost))
+
+	mux.Handle("POST /comment/create", protectedStack.ThenFunc(app.commentCreatePost))
+	mux.Handle("POST /comment/edit", protectedStack.ThenFunc(app.commentEditPost))
+	mux.Handle("POST /comment/delete", protectedStack.ThenFunc(app.commentDeletePost))
+
+	mux.Handle("GET /moderation", moderatorStack.ThenFunc(app.moderationQueue))
+	mux.Handle("POST /moderation/dismiss", moderatorStack.ThenFunc(app.moderationDismissPost))
+	mux.Handle("POST /moderation/hide", moderatorStack.ThenFunc(app.moderationHidePost))
+	mux.Handle("POST /moderation/ban", moderatorStack.ThenFunc(app.moderationBanPost))
+
+	mux.Handle("GET /collections", protectedStack.ThenFunc(app.collectionList))
+	mux.Handle("POST /collections", protectedStack.ThenFunc(app.collectionCreatePost))
+	mux.Handle("GET /collection/view/{id}", protectedStack.ThenFunc(app.collectionView))
+	mux.Handle("POST /collection/add", protectedStack.ThenFunc(app.collectionAddPost))
+	mux.Handle("POST /collection/remove", protectedStack.ThenFunc(app.collectionRemovePost))
+	mux.Handle("POST /collection/share", protectedStack.ThenFunc(app.collectionSharePost))
+	mux.Handle("POST /collection/unshare", protectedStack.ThenFunc(app.collectionUnsharePost))
 
 	/*
 	  Pass the servemux as the 'next' parameter to the commonHeaders middleware.
-	  Because commonHeaders is just a function, and the function returns a http.Handler we don't need to do anything else.
+	  Because commonHeaders is just a method value, and it returns a http.Handler we don't need to do anything else.
 
 	  It’s important to know that when the last handler in the chain returns, control is passed back up the chain in the reverse direction. So when our code is being executed the flow of control actually looks like this:
 
-	  recoverPanic → logRequest → commonHeaders → servemux → application handler → servemux → commonHeaders → logRequest → recoverPanic
+	  requestID → traceRequest → recoverPanic → logRequest → commonHeaders → servemux → application handler → servemux → commonHeaders → logRequest → recoverPanic → traceRequest → requestID
+
+	  requestID goes first so that even the 500 sent by recoverPanic carries the request ID, and traceRequest comes right after so the span covers everything else, including panics.
 	*/
 	standardStack := MiddlewareChain{
 		handlers: []Middleware{
+			requestID,
+			app.traceRequest,
 			app.recoverPanic,
 			app.logRequest,
-			commonHeaders,
+			app.commonHeaders,
 		}}
 
 	return standardStack.Then(mux)
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/scan"
+)
+
+// newScanPipeline builds the content scanner from the configuration. The blocklist detector only exists when there is a blocklist file to read.
+func newScanPipeline(cfg config) (*scan.Pipeline, error) {
+	actions, err := cfg.scanActions()
+	if err != nil {
+		return nil, err
+	}
+
+	detectors := []scan.Detector{scan.AWSKeys(), scan.PrivateKeys(), scan.JWTs(), scan.LinkSpam()}
+
+	if cfg.ScanBlocklist != "" {
+		blocklist, err := scan.LoadBlocklist(cfg.ScanBlocklist)
+		if err != nil {
+			return nil, err
+		}
+
+		detectors = append(detectors, blocklist)
+	}
+
+	pipeline := &scan.Pipeline{}
+	for _, detector := range detectors {
+		pipeline.Add(detector, actions[detector.Name()])
+	}
+
+	return pipeline, nil
+}
+
+/*
+scanFiles runs the content scanner over every file of the create form. Findings that block become an error on the content of their file, the others are added to form.Warnings, and the form has to be sent again with "confirmed" checked before the snippet is posted.
+
+Encrypted snippets are skipped, their content is ciphertext and there is nothing to find in it.
+*/
+func (app *application) scanFiles(r *http.Request, form *snippetCreateTemplateData) {
+	if form.Encrypted {
+		return
+	}
+
+	for i, file := range form.Files {
+		findings := app.scanner.Scan(file.Content)
+
+		if blocking := scan.Blocking(findings); len(blocking) > 0 {
+			form.AddFormError(fmt.Sprintf("files.%d.content", i), scan.Messages(blocking, app.locale(r).T))
+		}
+
+		for _, warning := range scan.Warnings(findings) {
+			form.Warnings = append(form.Warnings, fmt.Sprintf("%s: %s", file.Name, app.t(r, warning.Message.Key, warning.Message.Args...)))
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/models"
+)
+
+/*
+Every logged in session has a row in the user_sessions table, with where and when it was last used, and keeps the ID of that row under userSessionIDSessionKey. Revoking a session deletes its row, along with the "remember me" series it was started by, and authenticate logs out sessions without one on their next request.
+
+This is needed because scs stores the sessions as opaque blobs, there is no way to ask it for the sessions of a user.
+*/
+
+// startUserSession records the current session as a logged in session of userID, call it right after putting the user ID in the session. rememberSeries is the "remember me" series the session belongs to, empty when there is none.
+func (app *application) startUserSession(r *http.Request, userID int, rememberSeries string) error {
+	id, err := app.userSessions.Create(r.Context(), userID, rememberSeries, clientIP(r), userAgent(r), app.sessionManager.Deadline(r.Context()))
+	if err != nil {
+		return err
+	}
+
+	app.sessionManager.Put(r.Context(), userSessionIDSessionKey, id)
+
+	return nil
+}
+
+// activeUserSession reports whether the current session of userID is still active, it's false after the session was revoked
+func (app *application) activeUserSession(r *http.Request, userID int) (bool, error) {
+	id := app.sessionManager.GetString(r.Context(), userSessionIDSessionKey)
+
+	// sessions that logged in before they were tracked are adopted, instead of logging everybody out
+	if id == "" {
+		err := app.startUserSession(r, userID, "")
+		if err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	return app.userSessions.Touch(r.Context(), id, userID, clientIP(r), userAgent(r))
+}
+
+// endSession logs out the current session. The token is renewed like when logging in, the privilege level of the session changes. The "remember me" cookie goes too, or the next request would log the user right back in.
+func (app *application) endSession(w http.ResponseWriter, r *http.Request) error {
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+
+	app.sessionManager.Remove(r.Context(), authenticatedUserIDSessionKey)
+	app.sessionManager.Remove(r.Context(), userSessionIDSessionKey)
+	app.clearRememberCookie(w)
+
+	return nil
+}
+
+// sessionRevokePost logs out one of the other sessions of the current user
+func (app *application) sessionRevokePost(w http.ResponseWriter, r *http.Request) {
+	var form sessionRevokeForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	// Delete only touches sessions of the user, so sending the ID of someone else's session does nothing. Neither does sending one that is gone already, like when the form was sent twice, and there's nothing to record then.
+	err = app.userSessions.Delete(r.Context(), form.SessionID, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", app.t(r, "That session was already logged out"))
+			http.Redirect(w, r, "/account", http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, models.AuditSessionRevoke, userID, 0)
+
+	// revoking the current session is a logout
+	if form.SessionID == app.sessionManager.GetString(r.Context(), userSessionIDSessionKey) {
+		err = app.endSession(w, r)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.sessionManager.Put(r.Context(), "flash", app.t(r, "You logged out successfully"))
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", app.t(r, "Session logged out"))
+
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+// logoutEverywherePost logs out every session of the current user, this one included
+func (app *application) logoutEverywherePost(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	err := app.userSessions.DeleteAll(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, models.AuditLogoutEverywhere, userID, 0)
+
+	err = app.endSession(w, r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", app.t(r, "You were logged out everywhere"))
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
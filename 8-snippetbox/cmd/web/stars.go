@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/models"
+)
+
+// snippetStarPost and snippetUnstarPost are both sent by the star button on the view page, which one depends on whether the user already starred the snippet
+func (app *application) snippetStarPost(w http.ResponseWriter, r *http.Request) {
+	app.setStar(w, r, true)
+}
+
+func (app *application) snippetUnstarPost(w http.ResponseWriter, r *http.Request) {
+	app.setStar(w, r, false)
+}
+
+func (app *application) setStar(w http.ResponseWriter, r *http.Request, starred bool) {
+	var form starForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// you can only star what you can see
+	snippet, ok := app.viewableSnippet(w, r, form.SnippetID)
+	if !ok {
+		return
+	}
+
+	if starred {
+		err = app.snippets.Star(r.Context(), snippet.ID, app.authenticatedUserID(r))
+	} else {
+		err = app.snippets.Unstar(r.Context(), snippet.ID, app.authenticatedUserID(r))
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+func (app *application) starredList(w http.ResponseWriter, r *http.Request) {
+	starred, err := app.snippets.StarredBy(r.Context(), app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// stars stay when a private snippet stops being shared with the user, but the snippet must disappear from the list
+	var snippets []models.Snippet
+	for _, snippet := range starred {
+		allowed, err := app.canViewSnippet(r, snippet)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if allowed {
+			snippets = append(snippets, snippet)
+		}
+	}
+
+	data := app.newTemplateData(r, homeTemplateData{
+		Snippets: snippets,
+	})
+
+	app.render(w, r, http.StatusOK, "starred.tmpl.html", data)
+}
+
+// popular lists the public snippets that got the most stars and views this week
+func (app *application) popular(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.snippets.Popular(r.Context(), 20)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r, homeTemplateData{
+		Snippets: snippets,
+	})
+
+	app.render(w, r, http.StatusOK, "popular.tmpl.html", data)
+}
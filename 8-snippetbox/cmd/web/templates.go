@@ -1,35 +1,238 @@
 package main
 
 import (
+	"html/template"
+	"math"
 	"path/filepath"
-	"text/template"
 	"time"
 
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/i18n"
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/markdown"
 	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/models"
 	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/validator"
 )
 
 type snippetViewTemplateData struct {
 	Snippet models.Snippet
+	// The collections the current user can add the snippet to
+	Collections []models.Collection
+	// The snippet this one was forked from, the zero value when it isn't a fork or the user can't see the original
+	ForkedFrom models.Snippet
+	Forks      []models.Snippet
+	// Threads of comments about the whole snippet
+	Comments []models.Comment
+	Files    []snippetFileView
+	// The comment and reply forms share commentForm, ParentID tells which one failed validation
+	CommentForm commentForm
+	EditForm    commentEditForm
+	// Whether the current user starred the snippet
+	Starred bool
+	// The report form is folded away unless it failed validation
+	ReportForm reportForm
+}
+
+// A file of the snippet as displayed on the view page
+type snippetFileView struct {
+	models.SnippetFile
+	// The position of the file, comments refer to files by it
+	Index int
+	// The content split in lines with the threads anchored to each of them, used to display code and plain text line by line. Markdown isn't displayed line by line, so it lists the same threads from Annotations instead.
+	Lines       []snippetLine
+	Annotations []models.Comment
+}
+
+// A line of a file, the Annotations are the threads whose range ends on it, so they are displayed right below the lines they are about
+type snippetLine struct {
+	Number      int
+	Text        string
+	Annotations []models.Comment
+}
+
+// Used to post comments and replies. LineStart and LineEnd are optional, and only allowed on comments that start a thread.
+type commentForm struct {
+	SnippetID int    `form:"snippet_id"`
+	ParentID  int    `form:"parent_id"`
+	File      int    `form:"file"`
+	LineStart int    `form:"line_start"`
+	LineEnd   int    `form:"line_end"`
+	Content   string `form:"content"`
+
+	validator.Validator `form:"-"`
+}
+
+type commentEditForm struct {
+	CommentID int    `form:"comment_id"`
+	Content   string `form:"content"`
+
+	validator.Validator `form:"-"`
+}
+
+// Used by the star and unstar buttons
+type starForm struct {
+	SnippetID int `form:"snippet_id"`
+}
+
+type commentDeleteForm struct {
+	CommentID int `form:"comment_id"`
+}
+
+type reportForm struct {
+	SnippetID int    `form:"snippet_id"`
+	Reason    string `form:"reason"`
+	Details   string `form:"details"`
+
+	validator.Validator `form:"-"`
+}
+
+type accountTemplateData struct {
+	Events   []models.AuditEvent
+	Sessions []models.UserSession
+	// The ID of the session the page is displayed in, so it can be told apart from the others
+	CurrentSessionID string
+	// The locale the user picked, empty when the browser decides
+	LocalePreference string
+	// Holds the time zone the user picked, empty when the browser decides
+	TimeZoneForm timeZoneForm
+}
+
+type localeForm struct {
+	Locale string `form:"locale"`
+}
+
+type timeZoneForm struct {
+	TimeZone string `form:"time_zone"`
+
+	validator.Validator `form:"-"`
+}
+
+type sessionRevokeForm struct {
+	SessionID string `form:"session_id"`
+}
+
+type webhooksTemplateData struct {
+	Webhooks   []models.Webhook
+	Deliveries []models.WebhookDelivery
+	Form       webhookForm
+}
+
+type webhookForm struct {
+	URL string `form:"url"`
+
+	validator.Validator `form:"-"`
+}
+
+type webhookDeleteForm struct {
+	WebhookID int `form:"webhook_id"`
+}
+
+type moderationTemplateData struct {
+	Reports []models.Report
+	Log     []models.ModerationAction
+}
+
+// The dismiss, hide and ban buttons of the moderation queue all send the report they are about
+type moderationForm struct {
+	ReportID int `form:"report_id"`
+}
+
+// commentThread is what the recursive "comment" template receives. Inside a template called with {{template}} the page data isn't reachable anymore, so every comment carries the root data along.
+type commentThread struct {
+	models.Comment
+	Root rootTemplateData
+}
+
+type rateLimitedTemplateData struct {
+	// How long until the request can be made again, in whole seconds
+	RetryAfter time.Duration
 }
 
 type homeTemplateData struct {
 	Snippets []models.Snippet
 }
 
+type tagTemplateData struct {
+	Tags     []string
+	MatchAll bool
+	Snippets []models.Snippet
+	Counts   []models.TagCount
+}
+
 /*
 Struct tags tell the decoder how to map HTML form values into the different struct fields. So, for example, here we're telling the decoder to store the value from the HTML form input with the name "title" in the Title field. The struct tag `form:"-"` tells the decoder to completely ignore a field during decoding.
 */
 type snippetCreateTemplateData struct {
-	Title   string `form:"title"`
-	Content string `form:"content"`
-	Expires int    `form:"expires"`
+	Title string `form:"title"`
+	// The decoder fills slices of structs from indexed names, like "files[0].name". Rows can be removed in the browser, so there can be gaps in the indexes, the decoder leaves empty structs in them.
+	Files   []snippetFileForm `form:"files"`
+	Tags    string            `form:"tags"`
+	Private bool              `form:"private"`
+	// Set by the encrypt checkbox, main.js encrypts the content of the files before the form is sent
+	Encrypted bool `form:"encrypted"`
+	Expires   int  `form:"expires"`
+	// Set when the form was opened with the Fork button
+	ForkedFromID int `form:"forked_from_id"`
+	// Set by the checkbox shown with the Warnings, the user read them and wants to post the snippet anyway
+	Confirmed bool `form:"confirmed"`
+	// What the content scanner warned about, see scanFiles
+	Warnings []string `form:"-"`
 
 	// learn more about type embedding
 	// https://eli.thegreenplace.net/2020/embedding-in-go-part-1-structs-in-structs/
 	validator.Validator `form:"-"`
 }
 
+type snippetFileForm struct {
+	Name     string `form:"name"`
+	Language string `form:"language"`
+	Content  string `form:"content"`
+}
+
+// Used by the live preview, it only sends the content of the file being edited
+type snippetPreviewForm struct {
+	Content string `form:"content"`
+}
+
+type collectionsTemplateData struct {
+	Collections []models.Collection
+	Form        collectionCreateForm
+}
+
+type collectionCreateForm struct {
+	Name string `form:"name"`
+
+	validator.Validator `form:"-"`
+}
+
+// The collection page has more than one form, each one gets its own struct (and validator) so errors show up next to the right form
+type collectionTemplateData struct {
+	Collection models.Collection
+	Snippets   []models.Snippet
+	Members    []models.CollectionMember
+	AddForm    collectionSnippetForm
+	ShareForm  collectionShareForm
+}
+
+// Used to add and remove snippets
+type collectionSnippetForm struct {
+	CollectionID int `form:"collection_id"`
+	SnippetID    int `form:"snippet_id"`
+
+	validator.Validator `form:"-"`
+}
+
+type collectionShareForm struct {
+	CollectionID int    `form:"collection_id"`
+	Email        string `form:"email"`
+	Permission   string `form:"permission"`
+
+	validator.Validator `form:"-"`
+}
+
+type collectionUnshareForm struct {
+	CollectionID int `form:"collection_id"`
+	UserID       int `form:"user_id"`
+}
+
 type userSignupTemplateData struct {
 	Name     string `form:"name"`
 	Email    string `form:"email"`
@@ -41,21 +244,174 @@ type userSignupTemplateData struct {
 type userLoginTemplateData struct {
 	Email    string `form:"email"`
 	Password string `form:"password"`
+	// Keeps the user logged in for config.RememberLifetime instead of a single session
+	RememberMe bool `form:"remember_me"`
 
 	validator.Validator `form:"-"`
 }
 
-// template functions can take as many arguments as they need but MUST return a single value, UNLESS the second value is an error
-func humanDate(t time.Time) string {
-	return t.Format("02 jan 2006 at 15:04")
+// humanDuration rounds a duration up to the biggest unit that fits, like "3 minutes", it's for telling people how long to wait so rounding down would be a lie
+func humanDuration(locale *i18n.Locale, d time.Duration) string {
+	if d > time.Hour {
+		return locale.N("%d hours", int(math.Ceil(d.Hours())))
+	} else if d > time.Minute {
+		return locale.N("%d minutes", int(math.Ceil(d.Minutes())))
+	}
+
+	return locale.N("%d seconds", int(math.Ceil(d.Seconds())))
+}
+
+// relativeTime describes when t is from now, like "in 3 days" or "2 hours ago", rounded to the nearest whole unit. Months are 30 days and years 365, it's only meant to give an idea, the exact date goes in a tooltip.
+func relativeTime(locale *i18n.Locale, t, now time.Time) string {
+	d := t.Sub(now)
+
+	future := d > 0
+	if !future {
+		d = -d
+	}
+
+	day := 24 * time.Hour
+
+	var amount string
+	switch {
+	case d < time.Minute:
+		return locale.T("just now")
+	case d < time.Hour:
+		amount = locale.N("%d minutes", int(math.Round(d.Minutes())))
+	case d < day:
+		amount = locale.N("%d hours", int(math.Round(d.Hours())))
+	case d < 30*day:
+		amount = locale.N("%d days", int(math.Round(float64(d)/float64(day))))
+	case d < 365*day:
+		amount = locale.N("%d months", int(math.Round(float64(d)/float64(30*day))))
+	default:
+		amount = locale.N("%d years", int(math.Round(float64(d)/float64(365*day))))
+	}
+
+	if future {
+		return locale.T("in %s", amount)
+	}
+
+	return locale.T("%s ago", amount)
+}
+
+func thread(comment models.Comment, root rootTemplateData) commentThread {
+	return commentThread{Comment: comment, Root: root}
+}
+
+// languageName returns the display name of a language, or the ID itself for languages that were removed from models.Languages
+func languageName(id string) string {
+	for _, language := range models.Languages {
+		if language.ID == id {
+			return language.Name
+		}
+	}
+
+	return id
+}
+
+// auditEventName describes an audit event for the account page
+func auditEventName(event string) string {
+	switch event {
+	case models.AuditSignup:
+		return "Signed up"
+	case models.AuditLogin:
+		return "Logged in"
+	case models.AuditLoginFailure:
+		return "Failed login attempt"
+	case models.AuditLogout:
+		return "Logged out"
+	case models.AuditSnippetCreate:
+		return "Created a snippet"
+	case models.AuditSessionRevoke:
+		return "Logged out a session"
+	case models.AuditLogoutEverywhere:
+		return "Logged out everywhere"
+	case models.AuditRememberLogin:
+		return "Logged in with \"remember me\""
+	case models.AuditRememberTheft:
+		return "Someone used a copy of a \"remember me\" login, all sessions were logged out"
+	case models.AuditWebhookCreate:
+		return "Added a webhook"
+	case models.AuditWebhookDelete:
+		return "Deleted a webhook"
+	}
+
+	return event
+}
+
+// reportReasonName returns the display name of a report reason, or the ID itself for reasons that were removed from models.ReportReasons
+func reportReasonName(id string) string {
+	for _, reason := range models.ReportReasons {
+		if reason.ID == id {
+			return reason.Name
+		}
+	}
+
+	return id
 }
 
 // this will act as a lookup between the names of our functions
+// markdown returns sanitized HTML, see internal/markdown for how that's done
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"markdown": markdown.Render,
+	"thread":   thread,
+	// the create form loops over them to build the language selects
+	"languages":    func() []models.Language { return models.Languages },
+	"languageName": languageName,
+	// the report form and the moderation queue
+	"reportReasons":    func() []models.ReportReason { return models.ReportReasons },
+	"reportReasonName": reportReasonName,
+	"auditEventName":   auditEventName,
+}
+
+/*
+localeFunctions are the template functions that depend on the language of the page. Every locale gets its own set of parsed templates with these functions bound to it, see newTemplateCache, which is cheaper than picking the locale on every call.
+
+template functions can take as many arguments as they need but MUST return a single value, UNLESS the second value is an error
+*/
+func localeFunctions(catalog *i18n.Catalog, locale *i18n.Locale) template.FuncMap {
+	return template.FuncMap{
+		// {{t "Home"}}, or {{t "Ban %s" .AuthorName}} with arguments
+		"t": locale.T,
+		// {{n "%d stars" .Stars}}, picks the plural form for the number
+		"n": locale.N,
+		// {{humanDate .Created $.TimeZone}}, the time zone comes from the request like the locale, but there are too many of them to parse the templates for each
+		"humanDate": func(t time.Time, zone *time.Location) string {
+			if zone == nil {
+				zone = time.UTC
+			}
+
+			return locale.Date(t.In(zone))
+		},
+		"humanDuration": func(d time.Duration) string {
+			return humanDuration(locale, d)
+		},
+		"relativeTime": func(t time.Time) string {
+			return relativeTime(locale, t, time.Now())
+		},
+		// for the language picker of the account page
+		"locales": catalog.Locales,
+	}
+}
+
+// newTemplateCache parses every page once per locale, the cache is keyed by the locale code and then by the page name
+func newTemplateCache(catalog *i18n.Catalog) (map[string]map[string]*template.Template, error) {
+	cache := map[string]map[string]*template.Template{}
+
+	for _, locale := range catalog.Locales() {
+		pages, err := newLocaleTemplateCache(localeFunctions(catalog, locale))
+		if err != nil {
+			return nil, err
+		}
+
+		cache[locale.Code()] = pages
+	}
+
+	return cache, nil
 }
 
-func newTemplateCache() (map[string]*template.Template, error) {
+func newLocaleTemplateCache(localeFunctions template.FuncMap) (map[string]*template.Template, error) {
 	cache := map[string]*template.Template{}
 
 	// this will give us a slice of all the filepaths for our application page templates
@@ -70,7 +426,7 @@ func newTemplateCache() (map[string]*template.Template, error) {
 
 		// parse root template
 		// the template.FuncMap must be registered with the template set before we can call parse, that means we need to use template.New to create an empty set, and register with Funcs
-		ts, err := template.New(name).Funcs(functions).ParseFiles("./ui/html/templates/root.tmpl.html")
+		ts, err := template.New(name).Funcs(functions).Funcs(localeFunctions).ParseFiles("./ui/html/templates/root.tmpl.html")
 		if err != nil {
 			return nil, err
 		}
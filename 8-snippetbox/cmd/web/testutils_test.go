@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-playground/form/v4"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/i18n"
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/telemetry"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+/*
+The templates and static files are read from ./ui, relative to the project root, which is where the binary is started from. go test runs the tests of a package in its own directory, so they move up to the root before anything else.
+*/
+func TestMain(m *testing.M) {
+	err := os.Chdir("../..")
+	if err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// testSpans is where the spans of a test application end up
+type testSpans struct {
+	provider *sdktrace.TracerProvider
+	exporter *tracetest.InMemoryExporter
+}
+
+// ended returns every span that ended so far. The provider batches spans like in production, so they are flushed first.
+func (s *testSpans) ended(t *testing.T) tracetest.SpanStubs {
+	t.Helper()
+
+	err := s.provider.ForceFlush(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s.exporter.GetSpans()
+}
+
+/*
+newTestApplication returns an application with everything the routes need that works without a database: templates, translations, sessions kept in memory (the default store of scs), and spans recorded in memory. The models are left nil, a test that reaches one either sets it or uses newTestDB.
+*/
+func newTestApplication(t *testing.T) (*application, *testSpans) {
+	t.Helper()
+
+	catalog, err := i18n.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	templateCache, err := newTemplateCache(catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider, err := telemetry.NewProvider(exporter, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	app := &application{
+		config:         defaultConfig(),
+		logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		views:          newViewCounter(),
+		webhookClient:  newWebhookClient(true),
+		catalog:        catalog,
+		templateCache:  templateCache,
+		formDecoder:    form.NewDecoder(),
+		sessionManager: scs.New(),
+		tracer:         provider.Tracer(telemetry.ScopeName),
+		propagator:     telemetry.Propagator(),
+	}
+
+	return app, &testSpans{provider: provider, exporter: exporter}
+}
+
+/*
+newTestDB connects to the database in SNIPPETBOX_TEST_DSN, with every migration applied (see DATABASE.md), with its queries traced into spans, and skips the test when the variable isn't set. Tests that use it clean up the rows they add, but it should still be a database of its own, never the real one.
+*/
+func newTestDB(t *testing.T, spans *testSpans) *pgxpool.Pool {
+	t.Helper()
+
+	dsn := os.Getenv("SNIPPETBOX_TEST_DSN")
+	if dsn == "" {
+		t.Skip("SNIPPETBOX_TEST_DSN is not set")
+	}
+
+	db, err := openDb(context.Background(), dsn, spans.provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	return db
+}
+
+// serve sends r through every route and middleware of app, the way the server would
+func serve(app *application, r *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	app.routes().ServeHTTP(rr, r)
+
+	return rr
+}
+
+func get(app *application, target string) *httptest.ResponseRecorder {
+	return serve(app, httptest.NewRequest(http.MethodGet, target, nil))
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/validator"
+
+	// the IANA time zone database, built into the binary so zones work on servers (and containers) that don't have it installed
+	_ "time/tzdata"
+)
+
+/*
+Dates are displayed in the time zone the user picked on the account page, or when they didn't pick one (or aren't logged in) in the one their browser reports. JavaScript can tell the zone of the browser but the request can't, so main.js keeps it in the "tz" cookie. Without either, which is the case for the very first page someone sees, dates are in UTC.
+
+Templates take the zone as an argument, {{humanDate .Created $.TimeZone}}, it's in rootTemplateData.
+*/
+
+// Name of the cookie main.js stores the time zone of the browser in
+const timeZoneCookieName = "tz"
+
+// time.LoadLocation reads and parses the zone every time, there are few enough zones to keep the ones we've seen
+var timeZones sync.Map
+
+// loadTimeZone returns the zone with this IANA name, like "America/Sao_Paulo"
+func loadTimeZone(name string) (*time.Location, error) {
+	if zone, ok := timeZones.Load(name); ok {
+		return zone.(*time.Location), nil
+	}
+
+	zone, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+
+	timeZones.Store(name, zone)
+	return zone, nil
+}
+
+// timeZone returns the time zone dates are displayed in for the current request
+func (app *application) timeZone(r *http.Request) *time.Location {
+	preference, _ := r.Context().Value(timeZonePreferenceContextKey).(string)
+
+	if preference == "" {
+		if cookie, err := r.Cookie(timeZoneCookieName); err == nil {
+			preference, _ = url.QueryUnescape(cookie.Value)
+		}
+	}
+
+	// LoadLocation takes "" and "Local" as well, they mean UTC and the zone of the server, neither is something a browser reports
+	if preference == "" || preference == "Local" {
+		return time.UTC
+	}
+
+	zone, err := loadTimeZone(preference)
+	if err != nil {
+		return time.UTC
+	}
+
+	return zone
+}
+
+// accountTimeZonePost saves the time zone the user picked on the account page, an empty one means the browser decides again
+func (app *application) accountTimeZonePost(w http.ResponseWriter, r *http.Request) {
+	var form timeZoneForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.MaxChars(form.TimeZone, 64), "time_zone", app.t(r, "This field cannot be more than %d characters long", 64))
+	if form.TimeZone != "" && form.Valid() {
+		_, err := loadTimeZone(form.TimeZone)
+		form.CheckField(err == nil && form.TimeZone != "Local", "time_zone", app.t(r, "This is not a time zone, use a name like America/Sao_Paulo"))
+	}
+
+	if !form.Valid() {
+		app.renderAccount(w, r, http.StatusUnprocessableEntity, &form)
+		return
+	}
+
+	err = app.users.SetTimeZone(r.Context(), app.authenticatedUserID(r), form.TimeZone)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", app.t(r, "Time zone saved"))
+
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
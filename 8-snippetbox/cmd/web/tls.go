@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+/*
+There are two ways of getting a certificate for the HTTPS server:
+
+  - files on disk (-tls-cert and -tls-key), generated by hand as described in GENERATE_CERT.md or by some external tool like certbot. They are loaded by certReloader, which reloads them when the process receives SIGHUP so renewed certificates are picked up without a restart.
+  - ACME (-acme), where autocert requests certificates from Let's Encrypt on the first TLS handshake for each allowed host, caches them on disk and renews them before they expire.
+
+Both plug into the server the same way, through tls.Config.GetCertificate, which is called on every handshake.
+*/
+
+// certReloader keeps the current certificate in memory and swaps it when reload is called. The mutex is needed because handshakes happen concurrently on many connections while the reload happens on the signal goroutine.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+
+	err := reloader.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// reload reads the key pair from disk. If anything is wrong with the new files the previous certificate is kept, so a bad deploy doesn't take the site down.
+func (c *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cert, nil
+}
+
+// watchSIGHUP reloads the certificate every time the process receives SIGHUP, like `kill -HUP <pid>` after renewing the files. It runs until the process exits.
+func (c *certReloader) watchSIGHUP(logger *slog.Logger) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		for range signals {
+			err := c.reload()
+			if err != nil {
+				logger.Error("failed to reload TLS certificate, keeping the previous one", "cert", c.certFile, "key", c.keyFile, "error", err.Error())
+				continue
+			}
+
+			logger.Info("reloaded TLS certificate", "cert", c.certFile)
+		}
+	}()
+}
+
+// newACMEManager sets up autocert with a disk cache, so certificates survive restarts (Let's Encrypt has strict rate limits), and a host allowlist, so nobody can make us request certificates for random domains by sending a different SNI.
+func newACMEManager(cfg config) *autocert.Manager {
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cfg.ACMECache),
+		HostPolicy: autocert.HostWhitelist(cfg.ACMEHosts...),
+		Email:      cfg.ACMEEmail,
+	}
+
+	if cfg.ACMEDirectory != "" {
+		manager.Client = &acme.Client{DirectoryURL: cfg.ACMEDirectory}
+	}
+
+	return manager
+}
+
+/*
+redirectToHTTPS sends every plain HTTP request to the same URL on the HTTPS server. Permanent redirects are cached by browsers, so after the first visit they'll go straight to HTTPS.
+
+The host of the target comes from the Host header, which the client picks. When hosts are given, which is the case with ACME, requests for any other host get a 400 instead of a redirect to wherever they asked for. Without ACME we don't know our host names, so every host is redirected.
+*/
+func redirectToHTTPS(httpsAddr string, hosts ...string) http.Handler {
+	// only the port of the HTTPS address matters, the host comes from the request
+	_, port, _ := net.SplitHostPort(httpsAddr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		// host names are case insensitive, autocert compares them the same way
+		if len(hosts) > 0 && !slices.ContainsFunc(hosts, func(allowed string) bool { return strings.EqualFold(allowed, host) }) {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		name       string
+		httpsAddr  string
+		hosts      []string
+		host       string
+		wantStatus int
+		wantTarget string
+	}{
+		{"any host without a list", ":443", nil, "example.com", http.StatusMovedPermanently, "https://example.com/snippet/view/1?x=1"},
+		{"port of the HTTPS server", ":8080", nil, "example.com:80", http.StatusMovedPermanently, "https://example.com:8080/snippet/view/1?x=1"},
+		{"listed host", ":443", []string{"example.com"}, "example.com", http.StatusMovedPermanently, "https://example.com/snippet/view/1?x=1"},
+		{"listed host in another case", ":443", []string{"example.com"}, "EXAMPLE.com:80", http.StatusMovedPermanently, "https://EXAMPLE.com/snippet/view/1?x=1"},
+		{"unlisted host", ":443", []string{"example.com"}, "evil.example", http.StatusBadRequest, ""},
+		{"subdomain of a listed host", ":443", []string{"example.com"}, "www.example.com", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/snippet/view/1?x=1", nil)
+			r.Host = tt.host
+			rr := httptest.NewRecorder()
+
+			redirectToHTTPS(tt.httpsAddr, tt.hosts...).ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if location := rr.Header().Get("Location"); location != tt.wantTarget {
+				t.Errorf("got Location %q, want %q", location, tt.wantTarget)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/models"
+)
+
+const (
+	// The largest file that can be uploaded, a snippet is for reading in the browser, anything bigger belongs somewhere else
+	maxUploadFileBytes = 1 << 20
+	// The whole body of the create form: the 20 files a snippet can have at their largest, plus room for the text fields
+	maxCreateBodyBytes = 20*maxUploadFileBytes + 1<<20
+	// How much of a multipart body is kept in memory while parsing it, the rest is written to temporary files
+	multipartMaxMemory = 4 << 20
+)
+
+/*
+readUploads adds the files uploaded with the "uploads" field of the create form as rows of the form, so they go through the same validation as the files typed in. An upload that can't be used gets an error on the "uploads" field instead.
+
+Only text is accepted:
+
+  - http.DetectContentType sniffs the first 512 bytes the same way browsers do, anything it doesn't think is text is rejected, like images, archives and executables
+  - sniffing only looks at the start of the file, so the whole content must also be valid UTF-8 and have no NUL bytes, which text never has
+*/
+func (app *application) readUploads(r *http.Request, form *snippetCreateTemplateData) {
+	if r.MultipartForm == nil {
+		return
+	}
+
+	// main.js disables the field when encryption is on, uploads would reach the server before they could be encrypted
+	if form.Encrypted {
+		if len(r.MultipartForm.File["uploads"]) > 0 {
+			form.AddFormError("uploads", app.t(r, "Uploaded files can't be encrypted, paste their content instead"))
+		}
+
+		return
+	}
+
+	// a field only has room for one error message, so the problems of every file are put together
+	var problems []string
+
+	for _, header := range r.MultipartForm.File["uploads"] {
+		// browsers only send the name, but some clients send the whole path, with backslashes when it comes from Windows. filepath.Base only knows the separator of the server, so they're turned into slashes first.
+		name := path.Base(strings.ReplaceAll(header.Filename, "\\", "/"))
+
+		content, err := readUpload(header)
+		if err != nil {
+			var uploadErr *uploadError
+			if !errors.As(err, &uploadErr) {
+				// readUpload only returns uploadErrors, this is here in case that changes
+				uploadErr = &uploadError{key: "the file couldn't be read"}
+			}
+
+			problems = append(problems, fmt.Sprintf("%s: %s", name, app.t(r, uploadErr.key, uploadErr.args...)))
+			continue
+		}
+
+		form.Files = append(form.Files, snippetFileForm{
+			Name:     name,
+			Language: models.LanguageForFileName(name),
+			Content:  content,
+		})
+	}
+
+	if len(problems) > 0 {
+		form.AddFormError("uploads", strings.Join(problems, ". "))
+	}
+}
+
+// uploadError is why an upload can't be used, written to be displayed to the user. It's kept as a message key and its arguments so it can be translated, see app.t.
+type uploadError struct {
+	key  string
+	args []any
+}
+
+func (e *uploadError) Error() string {
+	return fmt.Sprintf(e.key, e.args...)
+}
+
+// readUpload returns the content of an uploaded file, or an *uploadError
+func readUpload(header *multipart.FileHeader) (string, error) {
+	if header.Size > maxUploadFileBytes {
+		return "", &uploadError{key: "the file is larger than %d MB", args: []any{maxUploadFileBytes >> 20}}
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return "", &uploadError{key: "the file couldn't be read"}
+	}
+	defer file.Close()
+
+	// the size in the header comes from the client, so the read is limited too
+	data, err := io.ReadAll(io.LimitReader(file, maxUploadFileBytes+1))
+	if err != nil {
+		return "", &uploadError{key: "the file couldn't be read"}
+	}
+
+	if len(data) > maxUploadFileBytes {
+		return "", &uploadError{key: "the file is larger than %d MB", args: []any{maxUploadFileBytes >> 20}}
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		return "", &uploadError{key: "the file is empty"}
+	}
+
+	// the type is a MIME type like image/png, it reads the same in every language
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "text/") {
+		return "", &uploadError{key: "only text files can be uploaded, this looks like %s", args: []any{strings.Split(contentType, ";")[0]}}
+	}
+
+	if bytes.IndexByte(data, 0) != -1 || !utf8.Valid(data) {
+		return "", &uploadError{key: "only UTF-8 text files can be uploaded"}
+	}
+
+	// editors on Windows like to start UTF-8 files with a byte order mark, it's invisible and would end up in the content
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	return string(data), nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/*
+Views are counted in memory and written to the database every viewFlushInterval, all of them in one transaction, see models.SnippetModel.RecordViews. Views that happened since the last write are lost when the process stops, a few seconds of views is a fair price for not writing to the database on every page view.
+*/
+
+// How often the views counted in memory are written to the database
+const viewFlushInterval = 10 * time.Second
+
+// viewCounter holds the views that haven't been written yet, by snippet ID
+type viewCounter struct {
+	mu     sync.Mutex
+	counts map[int]int
+}
+
+func newViewCounter() *viewCounter {
+	return &viewCounter{counts: map[int]int{}}
+}
+
+// add counts n views of a snippet
+func (c *viewCounter) add(id, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[id] += n
+}
+
+// take returns the views counted so far and starts counting from zero again
+func (c *viewCounter) take() map[int]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := c.counts
+	c.counts = map[int]int{}
+
+	return counts
+}
+
+// runViewFlusher writes the counted views every viewFlushInterval until ctx is done
+func (app *application) runViewFlusher(ctx context.Context) {
+	ticker := time.NewTicker(viewFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.flushViews(ctx)
+		}
+	}
+}
+
+func (app *application) flushViews(ctx context.Context) {
+	counts := app.views.take()
+	if len(counts) == 0 {
+		return
+	}
+
+	err := app.snippets.RecordViews(ctx, counts)
+	if err != nil {
+		app.logger.Warn("failed to record views, trying again with the next batch", "snippets", len(counts), "error", err.Error())
+
+		// put back, so they're written along with the next batch
+		for id, n := range counts {
+			app.views.add(id, n)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestViewCounter(t *testing.T) {
+	c := newViewCounter()
+	c.add(1, 1)
+	c.add(2, 1)
+	c.add(1, 2)
+
+	batch := c.take()
+	want := map[int]int{1: 3, 2: 1}
+	if !maps.Equal(batch, want) {
+		t.Errorf("got %v; want %v", batch, want)
+	}
+
+	// counting starts from zero after a take, the batch that was taken isn't touched
+	c.add(2, 1)
+	if got := c.take(); !maps.Equal(got, map[int]int{2: 1}) {
+		t.Errorf("got %v after take; want map[2:1]", got)
+	}
+	if !maps.Equal(batch, want) {
+		t.Errorf("taken batch changed to %v", batch)
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/models"
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/validator"
+)
+
+/*
+Webhooks tell users about their snippets: a POST with a JSON models.WebhookPayload when one is created, hidden by a moderator or expires.
+
+Events go through an outbox, the webhook_deliveries table. The models write them in the transaction of the change itself, and runWebhooks sends whatever is due every few seconds, so a slow or broken webhook never slows down a request, and nothing is lost when the process restarts. A delivery that doesn't get a 2xx back is retried with exponential backoff, and given up on after webhookMaxAttempts. The webhooks page shows every delivery with what happened to it.
+
+Every delivery is signed, so receivers can tell it came from us and wasn't changed on the way:
+
+	X-Snippetbox-Signature: t=1700000000,v1=<hex HMAC-SHA256 of "1700000000.<body>", keyed with the secret of the webhook>
+
+The time is when the attempt was made, receivers should reject old ones so a delivery that was listened in on can't be replayed later.
+*/
+
+const (
+	// How often the outbox is checked for deliveries that are due
+	webhookPollInterval = 5 * time.Second
+	// How long a webhook gets to answer
+	webhookTimeout = 10 * time.Second
+	// How many deliveries are sent at the same time
+	webhookBatchSize = 20
+	// The first retry waits this long, every next one twice as long as the one before
+	webhookBackoff = 30 * time.Second
+	// 8 attempts are 7 waits, from 30 seconds up to 32 minutes, a webhook that's down for more than about an hour misses the event
+	webhookMaxAttempts = 8
+	// How much of an error or of a response body is kept for the delivery log
+	maxWebhookErrorLength = 500
+	// Deliveries that are done are deleted after this long, the delivery log only needs the recent ones
+	webhookDeliveryRetention = 30 * 24 * time.Hour
+	maxWebhooksPerUser       = 5
+)
+
+// webhookStore is what the webhook handlers and the dispatcher use of models.WebhookModel, an interface so the tests can see what the dispatcher records without a database
+type webhookStore interface {
+	Insert(ctx context.Context, userID int, url string) (models.Webhook, error)
+	ForUser(ctx context.Context, userID int) ([]models.Webhook, error)
+	Delete(ctx context.Context, id, userID int) error
+	Deliveries(ctx context.Context, userID, limit int) ([]models.WebhookDelivery, error)
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	Delivered(ctx context.Context, id, status int) error
+	Retry(ctx context.Context, id, status int, message string, wait time.Duration) error
+	EnqueueExpired(ctx context.Context, limit int) (int, error)
+	Prune(ctx context.Context, olderThan time.Duration, limit int) (int, error)
+}
+
+// signWebhook is the v1 signature of a delivery, the secret is used as it's shown to the user, hex and all
+func signWebhook(secret string, timestamp int64, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.%s", timestamp, payload)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+/*
+newWebhookClient returns the client deliveries are sent with. Users pick the URLs, so without care they could make the server send requests into its own network, to the database or a cloud metadata endpoint. The dialer checks the address it actually connects to, after DNS, so a name that resolves to a private address is refused too.
+
+Redirects aren't followed for the same reason, a 3xx counts as a failed delivery.
+*/
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = refusePrivateAddress
+	}
+
+	return &http.Client{
+		Timeout: webhookTimeout,
+		// a Transport of our own doesn't use the proxy from the environment, which would be the address the dialer checks
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConnsPerHost: 2,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func refusePrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	if !isPublicAddress(ip) {
+		return fmt.Errorf("%s is not a public address", ip)
+	}
+
+	return nil
+}
+
+/*
+nonPublicPrefixes are the networks webhooks can't be sent to: everything in the IANA special-purpose address registries that doesn't route on the internet, or that leads back into a network it shouldn't. It's spelled out instead of relying on the Is* methods of netip.Addr, those don't know about carrier-grade NAT, benchmarking or NAT64, for example.
+
+https://www.iana.org/assignments/iana-ipv4-special-registry/
+https://www.iana.org/assignments/iana-ipv6-special-registry/
+*/
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this network"
+	netip.MustParsePrefix("10.0.0.0/8"),      // private
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT, the other side is someone's internal network
+	netip.MustParsePrefix("127.0.0.0/8"),     // loopback
+	netip.MustParsePrefix("169.254.0.0/16"),  // link local, where cloud metadata endpoints live
+	netip.MustParsePrefix("172.16.0.0/12"),   // private
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("192.88.99.0/24"),  // 6to4 relays, deprecated
+	netip.MustParsePrefix("192.168.0.0/16"),  // private
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("224.0.0.0/4"),     // multicast
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, and the broadcast address
+
+	netip.MustParsePrefix("::/128"),         // unspecified
+	netip.MustParsePrefix("::1/128"),        // loopback
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, it can reach any IPv4 address, private ones included
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local NAT64
+	netip.MustParsePrefix("100::/64"),       // discard
+	netip.MustParsePrefix("2001::/23"),      // IETF protocol assignments, Teredo among them
+	netip.MustParsePrefix("2001:db8::/32"),  // documentation
+	netip.MustParsePrefix("2002::/16"),      // 6to4, it can carry any IPv4 address too
+	netip.MustParsePrefix("fc00::/7"),       // unique local, the private networks of IPv6
+	netip.MustParsePrefix("fe80::/10"),      // link local
+	netip.MustParsePrefix("fec0::/10"),      // site local, deprecated
+	netip.MustParsePrefix("ff00::/8"),       // multicast
+}
+
+// isPublicAddress tells whether ip is outside of every network in nonPublicPrefixes
+func isPublicAddress(ip netip.Addr) bool {
+	// IPv4 addresses written as IPv6 (::ffff:10.0.0.1) are checked as the IPv4 address they are, and Prefix.Contains never matches an address with a zone
+	ip = ip.Unmap().WithZone("")
+
+	if !ip.IsValid() {
+		return false
+	}
+
+	return !slices.ContainsFunc(nonPublicPrefixes, func(prefix netip.Prefix) bool {
+		return prefix.Contains(ip)
+	})
+}
+
+// runWebhooks checks the outbox every webhookPollInterval until ctx is done
+func (app *application) runWebhooks(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		app.dispatchWebhooks(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchWebhooks adds the events of snippets that expired since the last time, deletes old deliveries, then sends a batch of the deliveries that are due
+func (app *application) dispatchWebhooks(ctx context.Context) {
+	expired, err := app.webhooks.EnqueueExpired(ctx, 100)
+	if err != nil {
+		app.logger.Error("failed to enqueue expired snippet webhooks", "error", err.Error())
+	} else if expired > 0 {
+		app.logger.Debug("enqueued expired snippet webhooks", "snippets", expired)
+	}
+
+	// in small batches so it never holds up sending, a backlog is cleared a batch every webhookPollInterval
+	pruned, err := app.webhooks.Prune(ctx, webhookDeliveryRetention, 1000)
+	if err != nil {
+		app.logger.Error("failed to prune webhook deliveries", "error", err.Error())
+	} else if pruned > 0 {
+		app.logger.Debug("pruned webhook deliveries", "deliveries", pruned)
+	}
+
+	// the lease outlasts the attempt, so nobody else picks the deliveries up while we are still waiting on them
+	deliveries, err := app.webhooks.Claim(ctx, webhookBatchSize, 2*webhookTimeout)
+	if err != nil {
+		app.logger.Error("failed to claim webhook deliveries", "error", err.Error())
+		return
+	}
+
+	// at the same time, one slow webhook shouldn't hold up the others
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.deliverWebhook(ctx, delivery)
+		}()
+	}
+	wg.Wait()
+}
+
+// deliverWebhook makes one attempt at a delivery and records how it went
+func (app *application) deliverWebhook(ctx context.Context, delivery models.WebhookDelivery) {
+	status, err := app.sendWebhook(ctx, delivery)
+	if err == nil {
+		err = app.webhooks.Delivered(ctx, delivery.ID, status)
+		if err != nil {
+			app.logger.Error("failed to record webhook delivery", "delivery_id", delivery.ID, "error", err.Error())
+		}
+		return
+	}
+
+	attempt := delivery.Attempts + 1
+
+	// 0 gives up
+	var wait time.Duration
+	if attempt < webhookMaxAttempts {
+		wait = webhookRetryWait(attempt)
+	}
+
+	app.logger.Warn("webhook delivery failed", "delivery_id", delivery.ID, "webhook_id", delivery.WebhookID, "attempt", attempt, "status", status, "retry_in", wait, "error", err.Error())
+
+	message := err.Error()
+	if len(message) > maxWebhookErrorLength {
+		message = strings.ToValidUTF8(message[:maxWebhookErrorLength], "")
+	}
+
+	err = app.webhooks.Retry(ctx, delivery.ID, status, message, wait)
+	if err != nil {
+		app.logger.Error("failed to record webhook delivery", "delivery_id", delivery.ID, "error", err.Error())
+	}
+}
+
+// webhookRetryWait is how long to wait after the nth failed attempt. Up to a tenth is added at random, so the deliveries to a webhook that was down don't all come back at the same moment.
+func webhookRetryWait(attempt int) time.Duration {
+	wait := webhookBackoff << (attempt - 1)
+
+	return wait + rand.N(wait/10)
+}
+
+// sendWebhook posts a delivery, and returns the status of the response, 0 when there wasn't one. Anything but a 2xx is an error.
+func (app *application) sendWebhook(ctx context.Context, delivery models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Snippetbox-Webhooks/"+readVersion().Version)
+	req.Header.Set("X-Snippetbox-Event", delivery.Event)
+	// the same for every attempt, so receivers can ignore a delivery they already got
+	req.Header.Set("X-Snippetbox-Delivery", strconv.Itoa(delivery.ID))
+	req.Header.Set("X-Snippetbox-Signature", fmt.Sprintf("t=%d,v1=%s", timestamp, signWebhook(delivery.Secret, timestamp, delivery.Payload)))
+
+	resp, err := app.webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// the start of the body usually says what went wrong, and reading it lets the connection be reused
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookErrorLength))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if text := strings.TrimSpace(string(body)); text != "" {
+			return resp.StatusCode, fmt.Errorf("unexpected response %s: %s", resp.Status, text)
+		}
+
+		return resp.StatusCode, fmt.Errorf("unexpected response %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// webhookList shows the webhooks of the current user and the log of their latest deliveries
+func (app *application) webhookList(w http.ResponseWriter, r *http.Request) {
+	app.renderWebhooks(w, r, http.StatusOK, webhookForm{})
+}
+
+func (app *application) renderWebhooks(w http.ResponseWriter, r *http.Request, status int, form webhookForm) {
+	webhooks, err := app.webhooks.ForUser(r.Context(), app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	deliveries, err := app.webhooks.Deliveries(r.Context(), app.authenticatedUserID(r), 50)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r, webhooksTemplateData{
+		Webhooks:   webhooks,
+		Deliveries: deliveries,
+		Form:       form,
+	})
+
+	app.render(w, r, status, "webhooks.tmpl.html", data)
+}
+
+func (app *application) webhookCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form webhookForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.URL), "url", app.t(r, "This field cannot be blank"))
+	form.CheckField(validator.MaxChars(form.URL, 2048), "url", app.t(r, "This field cannot be more than %d characters long", 2048))
+	if form.Valid() {
+		form.CheckField(app.validWebhookURL(form.URL), "url", app.t(r, "This field must be an https:// URL of a public address"))
+	}
+
+	webhooks, err := app.webhooks.ForUser(r.Context(), app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if len(webhooks) >= maxWebhooksPerUser {
+		form.AddNonFieldError(app.t(r, "You can't have more than %d webhooks, delete one first", maxWebhooksPerUser))
+	}
+
+	if !form.Valid() {
+		app.renderWebhooks(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	_, err = app.webhooks.Insert(r.Context(), app.authenticatedUserID(r), form.URL)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, models.AuditWebhookCreate, app.authenticatedUserID(r), 0)
+
+	app.sessionManager.Put(r.Context(), "flash", app.t(r, "Webhook added"))
+
+	http.Redirect(w, r, "/account/webhooks", http.StatusSeeOther)
+}
+
+// validWebhookURL tells the user early about URLs that would never get a delivery. Host names can't be checked here, they can resolve to anything later, the dialer of newWebhookClient catches those.
+func (app *application) validWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.User != nil {
+		return false
+	}
+
+	if app.config.WebhookAllowPrivate {
+		return validator.PermittedValue(u.Scheme, "http", "https")
+	}
+
+	if u.Scheme != "https" {
+		return false
+	}
+
+	if ip, err := netip.ParseAddr(u.Hostname()); err == nil {
+		return isPublicAddress(ip)
+	}
+
+	return u.Hostname() != "localhost"
+}
+
+func (app *application) webhookDeletePost(w http.ResponseWriter, r *http.Request) {
+	var form webhookDeleteForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.webhooks.Delete(r.Context(), form.WebhookID, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, models.AuditWebhookDelete, app.authenticatedUserID(r), 0)
+
+	app.sessionManager.Put(r.Context(), "flash", app.t(r, "Webhook deleted"))
+
+	http.Redirect(w, r, "/account/webhooks", http.StatusSeeOther)
+}
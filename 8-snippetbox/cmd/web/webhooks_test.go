@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marlonmarcello/learning-go/8-snippetbox/internal/models"
+)
+
+// fakeWebhookStore keeps the outbox in memory and records what the dispatcher reports. Every pending delivery is due, the waits are only recorded.
+type fakeWebhookStore struct {
+	webhookStore
+
+	mu         sync.Mutex
+	deliveries []models.WebhookDelivery
+	retries    []fakeRetry
+	delivered  []int
+	pruned     []time.Duration
+}
+
+type fakeRetry struct {
+	status  int
+	message string
+	wait    time.Duration
+}
+
+func (s *fakeWebhookStore) EnqueueExpired(ctx context.Context, limit int) (int, error) {
+	return 0, nil
+}
+
+func (s *fakeWebhookStore) Prune(ctx context.Context, olderThan time.Duration, limit int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pruned = append(s.pruned, olderThan)
+
+	return 0, nil
+}
+
+func (s *fakeWebhookStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []models.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		if delivery.State == models.DeliveryPending {
+			due = append(due, delivery)
+		}
+	}
+
+	return due, nil
+}
+
+func (s *fakeWebhookStore) Delivered(ctx context.Context, id, status int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.delivered = append(s.delivered, status)
+	s.update(id, models.DeliveryDelivered)
+
+	return nil
+}
+
+func (s *fakeWebhookStore) Retry(ctx context.Context, id, status int, message string, wait time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.retries = append(s.retries, fakeRetry{status: status, message: message, wait: wait})
+
+	state := models.DeliveryPending
+	if wait == 0 {
+		state = models.DeliveryFailed
+	}
+	s.update(id, state)
+
+	return nil
+}
+
+func (s *fakeWebhookStore) update(id int, state string) {
+	for i := range s.deliveries {
+		if s.deliveries[i].ID == id {
+			s.deliveries[i].State = state
+			s.deliveries[i].Attempts++
+		}
+	}
+}
+
+// receivedWebhook is what a test receiver got
+type receivedWebhook struct {
+	header http.Header
+	body   string
+}
+
+// newWebhookReceiver starts a server that records every request and answers with the next of statuses, the last one over and over once they run out
+func newWebhookReceiver(t *testing.T, statuses ...int) (*httptest.Server, func() []receivedWebhook) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var received []receivedWebhook
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		received = append(received, receivedWebhook{header: r.Header.Clone(), body: string(body)})
+		status := statuses[min(len(received), len(statuses))-1]
+		mu.Unlock()
+
+		w.WriteHeader(status)
+		if status >= 300 {
+			io.WriteString(w, "not today")
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []receivedWebhook {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]receivedWebhook(nil), received...)
+	}
+}
+
+func testDelivery(url string) models.WebhookDelivery {
+	return models.WebhookDelivery{
+		ID:        42,
+		WebhookID: 7,
+		URL:       url,
+		Secret:    strings.Repeat("ab", 32),
+		Event:     models.WebhookSnippetCreated,
+		Payload:   `{"event":"snippet.created","snippet":{"id":1}}`,
+		State:     models.DeliveryPending,
+	}
+}
+
+// Receivers check the signature the way the README tells them to, so this does the same instead of calling signWebhook
+func TestSendWebhookSignature(t *testing.T) {
+	app, _ := newTestApplication(t)
+	srv, received := newWebhookReceiver(t, http.StatusNoContent)
+
+	delivery := testDelivery(srv.URL)
+
+	status, err := app.sendWebhook(context.Background(), delivery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusNoContent {
+		t.Errorf("got status %d, want %d", status, http.StatusNoContent)
+	}
+
+	requests := received()
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(requests))
+	}
+	got := requests[0]
+
+	if got.body != delivery.Payload {
+		t.Errorf("got body %q, want %q", got.body, delivery.Payload)
+	}
+	if event := got.header.Get("X-Snippetbox-Event"); event != delivery.Event {
+		t.Errorf("got event %q, want %q", event, delivery.Event)
+	}
+	if id := got.header.Get("X-Snippetbox-Delivery"); id != "42" {
+		t.Errorf("got delivery %q, want %q", id, "42")
+	}
+	if contentType := got.header.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("got content type %q, want %q", contentType, "application/json")
+	}
+
+	timestamp, signature, ok := strings.Cut(got.header.Get("X-Snippetbox-Signature"), ",")
+	if !ok || !strings.HasPrefix(timestamp, "t=") || !strings.HasPrefix(signature, "v1=") {
+		t.Fatalf("malformed signature header %q", got.header.Get("X-Snippetbox-Signature"))
+	}
+	timestamp = strings.TrimPrefix(timestamp, "t=")
+	signature = strings.TrimPrefix(signature, "v1=")
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(unix, 0)).Abs() > time.Minute {
+		t.Errorf("got timestamp %q, want the time of the attempt", timestamp)
+	}
+
+	mac := hmac.New(sha256.New, []byte(delivery.Secret))
+	mac.Write([]byte(timestamp + "." + got.body))
+	want := hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(signature), []byte(want)) {
+		t.Errorf("got signature %s, want %s", signature, want)
+	}
+}
+
+// A delivery that doesn't get a 2xx is tried again later, each wait twice as long as the one before, until it gets one
+func TestDispatchWebhooksRetries(t *testing.T) {
+	app, _ := newTestApplication(t)
+	srv, received := newWebhookReceiver(t, http.StatusServiceUnavailable, http.StatusInternalServerError, http.StatusOK)
+
+	store := &fakeWebhookStore{deliveries: []models.WebhookDelivery{testDelivery(srv.URL)}}
+	app.webhooks = store
+
+	for range 4 {
+		app.dispatchWebhooks(context.Background())
+	}
+
+	if len(received()) != 3 {
+		t.Errorf("got %d attempts, want 3", len(received()))
+	}
+
+	wantRetries := []struct {
+		status  int
+		minWait time.Duration
+	}{
+		{http.StatusServiceUnavailable, webhookBackoff},
+		{http.StatusInternalServerError, 2 * webhookBackoff},
+	}
+
+	if len(store.retries) != len(wantRetries) {
+		t.Fatalf("got %d retries, want %d", len(store.retries), len(wantRetries))
+	}
+
+	for i, want := range wantRetries {
+		retry := store.retries[i]
+
+		if retry.status != want.status {
+			t.Errorf("retry %d: got status %d, want %d", i+1, retry.status, want.status)
+		}
+		if !strings.Contains(retry.message, "not today") {
+			t.Errorf("retry %d: got message %q, want the response body in it", i+1, retry.message)
+		}
+		// up to a tenth of jitter on top
+		if retry.wait < want.minWait || retry.wait >= want.minWait+want.minWait/10 {
+			t.Errorf("retry %d: got wait %s, want %s plus up to a tenth", i+1, retry.wait, want.minWait)
+		}
+	}
+
+	if len(store.delivered) != 1 || store.delivered[0] != http.StatusOK {
+		t.Errorf("got delivered %v, want one with status %d", store.delivered, http.StatusOK)
+	}
+}
+
+// The last attempt gives up instead of waiting again
+func TestDispatchWebhooksGivesUp(t *testing.T) {
+	app, _ := newTestApplication(t)
+	srv, _ := newWebhookReceiver(t, http.StatusInternalServerError)
+
+	delivery := testDelivery(srv.URL)
+	delivery.Attempts = webhookMaxAttempts - 1
+
+	store := &fakeWebhookStore{deliveries: []models.WebhookDelivery{delivery}}
+	app.webhooks = store
+
+	app.dispatchWebhooks(context.Background())
+
+	if len(store.retries) != 1 || store.retries[0].wait != 0 {
+		t.Fatalf("got retries %+v, want one without a wait", store.retries)
+	}
+	if state := store.deliveries[0].State; state != models.DeliveryFailed {
+		t.Errorf("got state %q, want %q", state, models.DeliveryFailed)
+	}
+	// the failed delivery stays around for the retention period, only older ones are pruned
+	if len(store.pruned) != 1 || store.pruned[0] != webhookDeliveryRetention {
+		t.Errorf("got pruned %v, want one with %s", store.pruned, webhookDeliveryRetention)
+	}
+}
+
+// A redirect could point anywhere, including the private addresses the dialer refuses, so it counts as a failure and isn't followed
+func TestSendWebhookDoesNotFollowRedirects(t *testing.T) {
+	app, _ := newTestApplication(t)
+
+	var followed bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hook", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/elsewhere", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/elsewhere", func(w http.ResponseWriter, r *http.Request) {
+		followed = true
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	status, err := app.sendWebhook(context.Background(), testDelivery(srv.URL+"/hook"))
+	if err == nil {
+		t.Error("got no error for a redirect")
+	}
+	if status != http.StatusTemporaryRedirect {
+		t.Errorf("got status %d, want %d", status, http.StatusTemporaryRedirect)
+	}
+	if followed {
+		t.Error("the redirect was followed")
+	}
+}
+
+// httptest servers listen on 127.0.0.1, which is just the kind of address webhooks must not reach
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.webhookClient = newWebhookClient(false)
+
+	srv, received := newWebhookReceiver(t, http.StatusOK)
+
+	status, err := app.sendWebhook(context.Background(), testDelivery(srv.URL))
+	if err == nil || !strings.Contains(err.Error(), "is not a public address") {
+		t.Errorf("got error %v, want the address to be refused", err)
+	}
+	if status != 0 {
+		t.Errorf("got status %d, want 0", status)
+	}
+	if len(received()) != 0 {
+		t.Error("the request reached the server")
+	}
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{"93.184.215.14", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		// cloud metadata endpoints
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+		// IPv4 in IPv6 clothing
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:93.184.215.14", true},
+		// carrier-grade NAT, and the addresses right outside of it
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"100.63.255.255", true},
+		{"100.128.0.1", true},
+		{"0.1.2.3", false},
+		// benchmarking
+		{"198.18.0.1", false},
+		{"198.19.255.255", false},
+		{"198.20.0.1", true},
+		{"192.0.2.1", false},
+		{"255.255.255.255", false},
+		// NAT64 reaches any IPv4 address, public ones are refused too
+		{"64:ff9b::a00:1", false},
+		{"64:ff9b::5db8:d70e", false},
+		{"2002:a00:1::1", false},
+		{"2001:db8::1", false},
+		{"fe80::1%eth0", false},
+		{"ff02::1", false},
+		{"::", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			if got := isPublicAddress(netip.MustParseAddr(tt.address)); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Package i18n translates the user interface. Every locale is a JSON file in locales/, embedded in the binary.
+
+Messages are looked up by their English text, like gettext does, so templates and handlers read the same as before: T("Home") is "Home" in English, and "Início" in Portuguese. A message missing from a locale falls back to the English text, a translation that is behind only shows up half translated instead of broken.
+
+A message is either a string, or an object with one string per plural form for messages about a number, see Locale.N:
+
+	"%d stars": {"one": "%d estrela", "other": "%d estrelas"}
+
+The forms are the CLDR plural categories (zero, one, two, few, many and other), which ones a language uses comes from golang.org/x/text/feature/plural. "other" is always needed.
+*/
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+)
+
+//go:embed locales/*.json
+var files embed.FS
+
+// The locale used when nothing else matches, its messages are the keys of every other locale
+const Default = "en"
+
+// The names of the plural forms in the locale files, indexed by plural.Form
+var pluralForms = map[plural.Form]string{
+	plural.Other: "other",
+	plural.Zero:  "zero",
+	plural.One:   "one",
+	plural.Two:   "two",
+	plural.Few:   "few",
+	plural.Many:  "many",
+}
+
+// message holds the text of a message for each plural form, messages that aren't about a number only have "other"
+type message map[string]string
+
+func (m *message) UnmarshalJSON(data []byte) error {
+	var text string
+	if json.Unmarshal(data, &text) == nil {
+		*m = message{"other": text}
+		return nil
+	}
+
+	var forms map[string]string
+	err := json.Unmarshal(data, &forms)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := forms["other"]; !ok {
+		return fmt.Errorf("plural message %s has no \"other\" form", data)
+	}
+
+	*m = forms
+	return nil
+}
+
+// The format of the files in locales/
+type localeFile struct {
+	// The name of the language in the language itself, for the language picker
+	Name string `json:"name"`
+	// A Go time layout, where "Jan" is replaced with the month from Months instead of the English one
+	Date     string             `json:"date"`
+	Months   [12]string         `json:"months"`
+	Messages map[string]message `json:"messages"`
+}
+
+type Locale struct {
+	Tag  language.Tag
+	Name string
+
+	date     string
+	months   [12]string
+	messages map[string]message
+}
+
+// Code is the BCP 47 tag of the locale, like "pt-BR", for the lang attribute and for storing the preference of a user
+func (l *Locale) Code() string {
+	return l.Tag.String()
+}
+
+// T translates key, and formats it with args like fmt.Sprintf when there are any
+func (l *Locale) T(key string, args ...any) string {
+	text := key
+	if m, ok := l.messages[key]; ok {
+		text = m["other"]
+	}
+
+	if len(args) == 0 {
+		return text
+	}
+
+	return fmt.Sprintf(text, args...)
+}
+
+// N translates key in the plural form the language uses for n, and formats it with n followed by args
+func (l *Locale) N(key string, n int, args ...any) string {
+	text := key
+	if m, ok := l.messages[key]; ok {
+		text = m["other"]
+
+		// the rules only look at the number, so negative numbers get the form of their absolute value
+		i := n
+		if i < 0 {
+			i = -i
+		}
+
+		if form, ok := m[pluralForms[plural.Cardinal.MatchPlural(l.Tag, i, 0, 0, 0, 0)]]; ok {
+			text = form
+		}
+	}
+
+	return fmt.Sprintf(text, append([]any{n}, args...)...)
+}
+
+// Date formats t with the layout of the locale. Go only knows English month names, so the layout is cut at every "Jan" and the month of the locale is put in between.
+func (l *Locale) Date(t time.Time) string {
+	parts := strings.Split(l.date, "Jan")
+	for i, part := range parts {
+		parts[i] = t.Format(part)
+	}
+
+	return strings.Join(parts, l.months[t.Month()-1])
+}
+
+// Catalog is every locale there is a file for
+type Catalog struct {
+	locales []*Locale
+	matcher language.Matcher
+}
+
+// Load reads the locales embedded in the binary. The default locale always comes first, the matcher falls back to the first locale it was given.
+func Load() (*Catalog, error) {
+	names, err := fs.Glob(files, "locales/*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Catalog{}
+
+	for _, name := range names {
+		data, err := files.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+
+		var file localeFile
+		err = json.Unmarshal(data, &file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		tag, err := language.Parse(strings.TrimSuffix(path.Base(name), ".json"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		locale := &Locale{Tag: tag, Name: file.Name, date: file.Date, months: file.Months, messages: file.Messages}
+
+		if locale.Code() == Default {
+			c.locales = append([]*Locale{locale}, c.locales...)
+		} else {
+			c.locales = append(c.locales, locale)
+		}
+	}
+
+	if len(c.locales) == 0 || c.locales[0].Code() != Default {
+		return nil, fmt.Errorf("the default locale %q is missing", Default)
+	}
+
+	tags := make([]language.Tag, len(c.locales))
+	for i, locale := range c.locales {
+		tags[i] = locale.Tag
+	}
+	c.matcher = language.NewMatcher(tags)
+
+	return c, nil
+}
+
+// Locales returns every locale, the default one first
+func (c *Catalog) Locales() []*Locale {
+	return c.locales
+}
+
+// Get returns the locale with exactly this code, for checking the preference a user picked
+func (c *Catalog) Get(code string) (*Locale, bool) {
+	for _, locale := range c.locales {
+		if locale.Code() == code {
+			return locale, true
+		}
+	}
+
+	return nil, false
+}
+
+/*
+Match picks the locale for a request. The preference of the user wins when they picked one, otherwise the languages of the Accept-Language header are tried in the order of their weights. The matcher knows which languages are close enough, so "pt" or "pt-PT" get the Brazilian locale rather than English.
+*/
+func (c *Catalog) Match(preference, acceptLanguage string) *Locale {
+	if locale, ok := c.Get(preference); ok {
+		return locale
+	}
+
+	// an Accept-Language that doesn't parse is treated like a missing one
+	tags, _, _ := language.ParseAcceptLanguage(acceptLanguage)
+
+	_, index, _ := c.matcher.Match(tags...)
+
+	return c.locales[index]
+}
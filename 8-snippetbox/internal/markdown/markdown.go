@@ -0,0 +1,53 @@
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+/*
+Rendering user supplied markdown safely happens in two steps:
+
+ 1. goldmark turns the markdown into HTML. By default it drops any raw HTML written in the markdown (it would need html.WithUnsafe() to keep it), so a <script> in a snippet never makes it through this step.
+ 2. bluemonday sanitizes the result against an allowlist of tags and attributes anyway. This is our real safety net: it removes anything we didn't explicitly allow, like iframes, event handlers or javascript: links, no matter how it was produced.
+
+https://github.com/yuin/goldmark
+https://github.com/microcosm-cc/bluemonday
+*/
+
+// GFM adds tables, strikethrough, autolinks and task lists, which is what people expect after writing READMEs on GitHub
+var renderer = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	// UGCPolicy is bluemonday's policy for user generated content: formatting, links, images, lists and tables, but no scripts, styles, iframes or forms
+	p := bluemonday.UGCPolicy()
+
+	// links in snippets are written by users, we don't want to pass our reputation to them (or help spammers)
+	p.RequireNoFollowOnLinks(true)
+	p.RequireNoReferrerOnLinks(true)
+
+	// GFM task lists render as disabled checkboxes, which is the only kind of input we let through
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+
+	return p
+}
+
+// Render converts markdown to sanitized HTML. The result is marked as template.HTML so html/template doesn't escape it a second time, which is only safe because it went through the sanitizer.
+func Render(source string) (template.HTML, error) {
+	var buff bytes.Buffer
+
+	err := renderer.Convert([]byte(source), &buff)
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(policy.SanitizeBytes(buff.Bytes())), nil
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The events recorded in audit_events
+const (
+	AuditSignup        = "signup"
+	AuditLogin         = "login"
+	AuditLoginFailure  = "login_failure"
+	AuditLogout        = "logout"
+	AuditSnippetCreate = "snippet_create"
+	// A session was logged out from the account page
+	AuditSessionRevoke    = "session_revoke"
+	AuditLogoutEverywhere = "logout_everywhere"
+	// A new session was started by a "remember me" cookie
+	AuditRememberLogin = "remember_login"
+	// A copy of a "remember me" cookie was used, see RememberModel.Use
+	AuditRememberTheft = "remember_theft"
+	// Webhooks get told about private snippets, adding one is worth knowing about
+	AuditWebhookCreate = "webhook_create"
+	AuditWebhookDelete = "webhook_delete"
+)
+
+type AuditEvent struct {
+	ID     int
+	UserID int
+	Event  string
+	// The snippet the event is about, 0 for events that aren't about a snippet
+	SnippetID int
+	IP        string
+	UserAgent string
+	Created   time.Time
+}
+
+// AuditModel writes and reads the audit_events table. The table is append only, there is no way to change or delete an event.
+type AuditModel struct {
+	DB *pgxpool.Pool
+}
+
+// Record stores an event, a UserID of 0 is stored as NULL for events that can't be tied to a user. The ID and Created fields are set by the database.
+func (m *AuditModel) Record(ctx context.Context, event AuditEvent) error {
+	statement := `INSERT INTO audit_events (user_id, event, snippet_id, ip, user_agent, created)
+  VALUES (NULLIF($1, 0), $2, NULLIF($3, 0), $4, $5, CURRENT_TIMESTAMP)`
+
+	_, err := m.DB.Exec(ctx, statement, event.UserID, event.Event, event.SnippetID, event.IP, event.UserAgent)
+
+	return err
+}
+
+// ForUser returns the latest events of a user, the most recent first
+func (m *AuditModel) ForUser(ctx context.Context, userID, limit int) ([]AuditEvent, error) {
+	statement := `SELECT id, user_id, event, COALESCE(snippet_id, 0) AS snippet_id, ip, user_agent, created FROM audit_events
+  WHERE user_id = $1 ORDER BY created DESC, id DESC LIMIT $2`
+
+	rows, _ := m.DB.Query(ctx, statement, userID, limit)
+	events, err := pgx.CollectRows(rows, pgx.RowToStructByName[AuditEvent])
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
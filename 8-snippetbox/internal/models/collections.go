@@ -0,0 +1,187 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// What a user is allowed to do with a collection, from least to most. PermissionNone is the zero value, so a user that isn't related to a collection at all gets it by default.
+const (
+	PermissionNone  = ""
+	PermissionRead  = "read"
+	PermissionWrite = "write"
+	PermissionOwner = "owner"
+)
+
+// The permissions a collection can be shared with, they match the CHECK constraint on collection_members.permission
+var SharePermissions = []string{PermissionRead, PermissionWrite}
+
+type Collection struct {
+	ID        int
+	UserID    int
+	OwnerName string
+	Name      string
+	// What the user that loaded the collection is allowed to do with it
+	Permission string
+	Snippets   int
+	Created    time.Time
+}
+
+// CanWrite reports if the permission allows adding and removing snippets
+func (c Collection) CanWrite() bool {
+	return c.Permission == PermissionOwner || c.Permission == PermissionWrite
+}
+
+type CollectionMember struct {
+	UserID     int
+	Name       string
+	Email      string
+	Permission string
+	Created    time.Time
+}
+
+type CollectionModel struct {
+	DB *pgxpool.Pool
+}
+
+// collectionColumns returns the columns of a Collection for queries on "collections c JOIN users u", user is the placeholder of the user ID the permission is calculated for, like "$2"
+func collectionColumns(user string) string {
+	return `c.id, c.user_id, u.name AS owner_name, c.name,
+  CASE WHEN c.user_id = ` + user + ` THEN 'owner'
+    ELSE COALESCE((SELECT cm.permission FROM collection_members cm WHERE cm.collection_id = c.id AND cm.user_id = ` + user + `), '')
+  END AS permission,
+  (SELECT COUNT(*) FROM collection_snippets cs WHERE cs.collection_id = c.id) AS snippets,
+  c.created`
+}
+
+func (m *CollectionModel) Insert(ctx context.Context, userID int, name string) (int, error) {
+	statement := `INSERT INTO collections (user_id, name, created) VALUES ($1, $2, CURRENT_TIMESTAMP) RETURNING id`
+
+	var newId int
+
+	err := m.DB.QueryRow(ctx, statement, userID, name).Scan(&newId)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "collections_user_id_name_key" {
+			return 0, ErrDuplicateName
+		}
+
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// Get returns the collection with the Permission of userID on it. It returns the collection even when that permission is PermissionNone, the caller decides what to do about it.
+func (m *CollectionModel) Get(ctx context.Context, id, userID int) (Collection, error) {
+	statement := `SELECT ` + collectionColumns("$2") + ` FROM collections c JOIN users u ON u.id = c.user_id WHERE c.id = $1`
+
+	rows, _ := m.DB.Query(ctx, statement, id, userID)
+	collection, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[Collection])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Collection{}, ErrNoRecord
+		}
+
+		return Collection{}, err
+	}
+
+	return collection, nil
+}
+
+// ForUser returns the collections a user owns or that were shared with them
+func (m *CollectionModel) ForUser(ctx context.Context, userID int) ([]Collection, error) {
+	// owned collections are listed first, then the shared ones
+	statement := `SELECT ` + collectionColumns("$1") + ` FROM collections c JOIN users u ON u.id = c.user_id
+  WHERE c.user_id = $1 OR EXISTS (SELECT 1 FROM collection_members cm WHERE cm.collection_id = c.id AND cm.user_id = $1)
+  ORDER BY c.user_id <> $1, c.name`
+
+	rows, _ := m.DB.Query(ctx, statement, userID)
+	collections, err := pgx.CollectRows(rows, pgx.RowToStructByName[Collection])
+	if err != nil {
+		return nil, err
+	}
+
+	return collections, nil
+}
+
+// Snippets returns the snippets in a collection that haven't expired, private ones included
+func (m *CollectionModel) Snippets(ctx context.Context, id int) ([]Snippet, error) {
+	statement := `SELECT ` + snippetColumns + ` FROM snippets s
+  JOIN collection_snippets cs ON cs.snippet_id = s.id
+  WHERE cs.collection_id = $1 AND s.expires > CURRENT_TIMESTAMP AND NOT s.hidden
+  ORDER BY cs.added DESC`
+
+	rows, _ := m.DB.Query(ctx, statement, id)
+	snippets, err := pgx.CollectRows(rows, pgx.RowToStructByName[Snippet])
+	if err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+func (m *CollectionModel) AddSnippet(ctx context.Context, id, snippetID int) error {
+	statement := `INSERT INTO collection_snippets (collection_id, snippet_id, added) VALUES ($1, $2, CURRENT_TIMESTAMP)
+  ON CONFLICT DO NOTHING`
+
+	_, err := m.DB.Exec(ctx, statement, id, snippetID)
+
+	return err
+}
+
+func (m *CollectionModel) RemoveSnippet(ctx context.Context, id, snippetID int) error {
+	_, err := m.DB.Exec(ctx, `DELETE FROM collection_snippets WHERE collection_id = $1 AND snippet_id = $2`, id, snippetID)
+
+	return err
+}
+
+func (m *CollectionModel) Members(ctx context.Context, id int) ([]CollectionMember, error) {
+	statement := `SELECT u.id AS user_id, u.name, u.email, cm.permission, cm.created FROM collection_members cm
+  JOIN users u ON u.id = cm.user_id WHERE cm.collection_id = $1 ORDER BY u.name`
+
+	rows, _ := m.DB.Query(ctx, statement, id)
+	members, err := pgx.CollectRows(rows, pgx.RowToStructByName[CollectionMember])
+	if err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// Share gives userID access to the collection, or changes their permission if they already had access
+func (m *CollectionModel) Share(ctx context.Context, id, userID int, permission string) error {
+	statement := `INSERT INTO collection_members (collection_id, user_id, permission, created) VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+  ON CONFLICT (collection_id, user_id) DO UPDATE SET permission = EXCLUDED.permission`
+
+	_, err := m.DB.Exec(ctx, statement, id, userID, permission)
+
+	return err
+}
+
+func (m *CollectionModel) Unshare(ctx context.Context, id, userID int) error {
+	_, err := m.DB.Exec(ctx, `DELETE FROM collection_members WHERE collection_id = $1 AND user_id = $2`, id, userID)
+
+	return err
+}
+
+// SharesSnippet reports if a snippet is in any collection that userID owns or is a member of. This is what lets members see private snippets of a shared collection.
+func (m *CollectionModel) SharesSnippet(ctx context.Context, snippetID, userID int) (bool, error) {
+	var shared bool
+
+	statement := `SELECT EXISTS(
+    SELECT 1 FROM collection_snippets cs JOIN collections c ON c.id = cs.collection_id
+    WHERE cs.snippet_id = $1 AND (c.user_id = $2 OR EXISTS (
+      SELECT 1 FROM collection_members cm WHERE cm.collection_id = c.id AND cm.user_id = $2
+    ))
+  )`
+
+	err := m.DB.QueryRow(ctx, statement, snippetID, userID).Scan(&shared)
+
+	return shared, err
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Comment struct {
+	ID        int
+	SnippetID int
+	UserID    int
+	UserName  string
+	// The comment this one replies to, 0 for comments at the top of a thread
+	ParentID int
+	// The position of the file and the range of lines in it the comment is about, the lines are both 0 for comments about the whole snippet
+	File      int
+	LineStart int
+	LineEnd   int
+	Content   string
+	Created   time.Time
+	Updated   time.Time
+	// Filled in by Threads, the db:"-" tag tells pgx this field doesn't come from a column
+	Replies []Comment `db:"-"`
+}
+
+// Anchored reports if the comment is attached to a range of lines
+func (c Comment) Anchored() bool {
+	return c.LineStart != 0
+}
+
+// Edited reports if the comment was changed after it was posted
+func (c Comment) Edited() bool {
+	return c.Updated.After(c.Created)
+}
+
+type CommentModel struct {
+	DB *pgxpool.Pool
+}
+
+const commentColumns = `c.id, c.snippet_id, c.user_id, u.name AS user_name, COALESCE(c.parent_id, 0) AS parent_id, c.file,
+  COALESCE(c.line_start, 0) AS line_start, COALESCE(c.line_end, 0) AS line_end, c.content, c.created, c.updated`
+
+// Insert stores a new comment and returns its ID. A LineStart of 0 stores a comment that isn't anchored to any line.
+func (m *CommentModel) Insert(ctx context.Context, comment Comment) (int, error) {
+	statement := `INSERT INTO comments (snippet_id, user_id, parent_id, file, line_start, line_end, content, created, updated)
+  VALUES ($1, $2, NULLIF($3, 0), $4, NULLIF($5, 0), NULLIF($6, 0), $7, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP) RETURNING id`
+
+	var newId int
+
+	err := m.DB.QueryRow(ctx, statement, comment.SnippetID, comment.UserID, comment.ParentID, comment.File, comment.LineStart, comment.LineEnd, comment.Content).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+func (m *CommentModel) Get(ctx context.Context, id int) (Comment, error) {
+	statement := `SELECT ` + commentColumns + ` FROM comments c JOIN users u ON u.id = c.user_id WHERE c.id = $1`
+
+	rows, _ := m.DB.Query(ctx, statement, id)
+	comment, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[Comment])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Comment{}, ErrNoRecord
+		}
+
+		return Comment{}, err
+	}
+
+	return comment, nil
+}
+
+// ForSnippet returns every comment of a snippet, oldest first, as a flat list. Use Threads to nest the replies.
+func (m *CommentModel) ForSnippet(ctx context.Context, snippetID int) ([]Comment, error) {
+	statement := `SELECT ` + commentColumns + ` FROM comments c JOIN users u ON u.id = c.user_id
+  WHERE c.snippet_id = $1 ORDER BY c.created, c.id`
+
+	rows, _ := m.DB.Query(ctx, statement, snippetID)
+	comments, err := pgx.CollectRows(rows, pgx.RowToStructByName[Comment])
+	if err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+func (m *CommentModel) Update(ctx context.Context, id int, content string) error {
+	_, err := m.DB.Exec(ctx, `UPDATE comments SET content = $2, updated = CURRENT_TIMESTAMP WHERE id = $1`, id, content)
+
+	return err
+}
+
+// Delete removes a comment, and with it all the replies in its thread
+func (m *CommentModel) Delete(ctx context.Context, id int) error {
+	_, err := m.DB.Exec(ctx, `DELETE FROM comments WHERE id = $1`, id)
+
+	return err
+}
+
+// Threads nests a flat list of comments, like the one returned by ForSnippet, into threads. It returns the top level comments with their Replies filled in, keeping the order of the list.
+func Threads(comments []Comment) []Comment {
+	children := map[int][]Comment{}
+	for _, comment := range comments {
+		children[comment.ParentID] = append(children[comment.ParentID], comment)
+	}
+
+	var nest func(parentID int) []Comment
+	nest = func(parentID int) []Comment {
+		thread := children[parentID]
+		for i := range thread {
+			thread[i].Replies = nest(thread[i].ID)
+		}
+
+		return thread
+	}
+
+	return nest(0)
+}
@@ -7,5 +7,11 @@ var (
 
 	ErrInvalidCredentials = errors.New("models: invalid credentials")
 
+	ErrBanned = errors.New("models: user is banned")
+
+	ErrStolenToken = errors.New("models: remember me token was used by someone else")
+
 	ErrDuplicateEmail = errors.New("models: duplicate email")
+
+	ErrDuplicateName = errors.New("models: duplicate name")
 )
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// The languages with special handling on the view page. Every other language is displayed as code, line by line.
+const (
+	LanguageText     = "text"
+	LanguageMarkdown = "markdown"
+	LanguageCode     = "code"
+)
+
+type Language struct {
+	// Stored in snippet_files.language and used as the language-* class of the code, so syntax highlighters can pick it up
+	ID   string
+	Name string
+	// Used to guess the language of uploaded files, lower case with the dot, or a whole file name for files like Dockerfile
+	Extensions []string
+}
+
+// Languages lists the languages a file can have, in the order they are offered on the create form
+var Languages = []Language{
+	{LanguageText, "Plain text", []string{".txt", ".log"}},
+	{LanguageMarkdown, "Markdown", []string{".md", ".markdown"}},
+	{LanguageCode, "Other code", nil},
+	{"c", "C", []string{".c", ".h"}},
+	{"cpp", "C++", []string{".cpp", ".cc", ".cxx", ".hpp"}},
+	{"csharp", "C#", []string{".cs"}},
+	{"css", "CSS", []string{".css"}},
+	{"dockerfile", "Dockerfile", []string{"dockerfile", ".dockerfile"}},
+	{"go", "Go", []string{".go"}},
+	{"html", "HTML", []string{".html", ".htm"}},
+	{"java", "Java", []string{".java"}},
+	{"javascript", "JavaScript", []string{".js", ".mjs", ".cjs"}},
+	{"json", "JSON", []string{".json"}},
+	{"php", "PHP", []string{".php"}},
+	{"python", "Python", []string{".py"}},
+	{"ruby", "Ruby", []string{".rb"}},
+	{"rust", "Rust", []string{".rs"}},
+	{"shell", "Shell", []string{".sh", ".bash", ".zsh"}},
+	{"sql", "SQL", []string{".sql"}},
+	{"toml", "TOML", []string{".toml"}},
+	{"typescript", "TypeScript", []string{".ts", ".tsx"}},
+	{"yaml", "YAML", []string{".yaml", ".yml"}},
+}
+
+func IsLanguage(id string) bool {
+	return slices.ContainsFunc(Languages, func(l Language) bool {
+		return l.ID == id
+	})
+}
+
+// LanguageForFileName guesses the language of a file from its extension, or its whole name, and falls back to plain text
+func LanguageForFileName(name string) string {
+	name = strings.ToLower(filepath.Base(name))
+
+	for _, language := range Languages {
+		if slices.Contains(language.Extensions, name) || slices.Contains(language.Extensions, filepath.Ext(name)) {
+			return language.ID
+		}
+	}
+
+	return LanguageText
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The migration files are embedded in the binary so the application always knows which schema version it was built against, even when it runs far away from the source tree.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations are applied by hand with psql (see DATABASE.md) because the "web" role the application connects with is not allowed to create tables. This model only reads the schema_migrations table to check the work has been done.
+type MigrationModel struct {
+	DB *pgxpool.Pool
+}
+
+// Versions returns the version of every embedded migration file, in ascending order. Files are named like 0001_initial.sql, the number before the first underscore is the version.
+func (m *MigrationModel) Versions() ([]int, error) {
+	names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]int, 0, len(names))
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(strings.TrimPrefix(name, "migrations/"), "_")
+
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("models: invalid migration file name %q", name)
+		}
+
+		versions = append(versions, version)
+	}
+
+	slices.Sort(versions)
+
+	return versions, nil
+}
+
+// Pending returns the versions that are embedded in the binary but have not been recorded in the schema_migrations table yet. An empty slice means the database is up to date.
+func (m *MigrationModel) Pending(ctx context.Context) ([]int, error) {
+	versions, err := m.Versions()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, _ := m.DB.Query(ctx, "SELECT version FROM schema_migrations")
+	applied, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []int{}
+	for _, version := range versions {
+		if !slices.Contains(applied, version) {
+			pending = append(pending, version)
+		}
+	}
+
+	return pending, nil
+}
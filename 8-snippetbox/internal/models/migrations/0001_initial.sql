@@ -0,0 +1,51 @@
+-- Keeps track of which migration files have been applied. Every migration
+-- records its own version as the last statement so /readyz can tell whether the
+-- database schema matches the binary.
+--
+-- Databases set up before there were migrations already have the snippets,
+-- sessions and users tables, so everything here is IF NOT EXISTS and this file
+-- can be applied to them too, see "Upgrading an existing database" in DATABASE.md.
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    applied TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create a `snippets` table.
+CREATE TABLE IF NOT EXISTS snippets (
+    id SERIAL PRIMARY KEY,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    created TIMESTAMPTZ NOT NULL,
+    expires TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_snippets_created ON snippets(created);
+
+-- Create a `sessions` table.
+CREATE TABLE IF NOT EXISTS sessions (
+    token CHAR(43) PRIMARY KEY,
+    data BYTEA NOT NULL,
+    expiry TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sessions_expiry_idx ON sessions (expiry);
+
+-- Create a `users` table.
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL UNIQUE, -- Define UNIQUE constraint inline
+    hashed_password CHAR(60) NOT NULL,  -- Suitable for bcrypt hashes
+    created TIMESTAMPTZ NOT NULL       -- Use TIMESTAMPTZ for consistency
+);
+-- Note: The UNIQUE constraint on email also automatically creates an index on that column.
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE snippets TO web;
+GRANT USAGE, SELECT ON SEQUENCE snippets_id_seq TO web;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE sessions TO web;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE users TO web;
+GRANT USAGE, SELECT ON SEQUENCE users_id_seq TO web;
+-- the application only needs to read this one, migrations are applied by a superuser
+GRANT SELECT ON TABLE schema_migrations TO web;
+
+INSERT INTO schema_migrations (version) VALUES (1) ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,8 @@
+-- How the content of a snippet is displayed: as plain text, as code, or rendered from markdown.
+-- Existing snippets were all shown inside <pre><code>, so they become "code".
+ALTER TABLE snippets ADD COLUMN format VARCHAR(16) NOT NULL DEFAULT 'plain'
+    CHECK (format IN ('plain', 'code', 'markdown'));
+
+UPDATE snippets SET format = 'code';
+
+INSERT INTO schema_migrations (version) VALUES (2);
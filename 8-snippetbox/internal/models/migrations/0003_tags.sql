@@ -0,0 +1,21 @@
+-- Tags are stored once and linked to snippets through snippet_tags, so renaming
+-- or counting a tag doesn't have to touch every snippet.
+CREATE TABLE tags (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(32) NOT NULL UNIQUE
+);
+
+CREATE TABLE snippet_tags (
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (snippet_id, tag_id)
+);
+
+-- The primary key covers lookups by snippet, this one covers lookups by tag.
+CREATE INDEX idx_snippet_tags_tag_id ON snippet_tags(tag_id);
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE tags TO web;
+GRANT USAGE, SELECT ON SEQUENCE tags_id_seq TO web;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE snippet_tags TO web;
+
+INSERT INTO schema_migrations (version) VALUES (3);
@@ -0,0 +1,43 @@
+-- Snippets now belong to the user who created them, and can be private. Older
+-- snippets have no owner and stay public.
+ALTER TABLE snippets ADD COLUMN user_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE snippets ADD COLUMN private BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_snippets_user_id ON snippets(user_id);
+
+-- A collection is a named group of snippets owned by a user.
+CREATE TABLE collections (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    created TIMESTAMPTZ NOT NULL,
+    CONSTRAINT collections_user_id_name_key UNIQUE (user_id, name)
+);
+
+CREATE TABLE collection_snippets (
+    collection_id INTEGER NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    added TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (collection_id, snippet_id)
+);
+
+CREATE INDEX idx_collection_snippets_snippet_id ON collection_snippets(snippet_id);
+
+-- Other users a collection is shared with. "read" members can browse the
+-- collection, "write" members can also add and remove snippets.
+CREATE TABLE collection_members (
+    collection_id INTEGER NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    permission VARCHAR(5) NOT NULL CHECK (permission IN ('read', 'write')),
+    created TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (collection_id, user_id)
+);
+
+CREATE INDEX idx_collection_members_user_id ON collection_members(user_id);
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE collections TO web;
+GRANT USAGE, SELECT ON SEQUENCE collections_id_seq TO web;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE collection_snippets TO web;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE collection_members TO web;
+
+INSERT INTO schema_migrations (version) VALUES (4);
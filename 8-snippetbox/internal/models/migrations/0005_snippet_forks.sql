@@ -0,0 +1,7 @@
+-- The snippet a snippet was forked from. When the original is deleted the fork
+-- stays around, it just loses the link.
+ALTER TABLE snippets ADD COLUMN forked_from_id INTEGER REFERENCES snippets(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_snippets_forked_from_id ON snippets(forked_from_id);
+
+INSERT INTO schema_migrations (version) VALUES (5);
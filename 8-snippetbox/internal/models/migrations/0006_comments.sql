@@ -0,0 +1,25 @@
+-- Comments on snippets. A comment with a parent_id is a reply in the thread of
+-- its parent, deleting a comment deletes its replies too. Top level comments can
+-- be anchored to a range of lines of the snippet content.
+CREATE TABLE comments (
+    id SERIAL PRIMARY KEY,
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    parent_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    line_start INTEGER,
+    line_end INTEGER,
+    content TEXT NOT NULL,
+    created TIMESTAMPTZ NOT NULL,
+    updated TIMESTAMPTZ NOT NULL,
+    CONSTRAINT comments_lines_check CHECK (
+        (line_start IS NULL AND line_end IS NULL)
+        OR (line_start >= 1 AND line_end >= line_start)
+    )
+);
+
+CREATE INDEX idx_comments_snippet_id ON comments(snippet_id);
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE comments TO web;
+GRANT USAGE, SELECT ON SEQUENCE comments_id_seq TO web;
+
+INSERT INTO schema_migrations (version) VALUES (6);
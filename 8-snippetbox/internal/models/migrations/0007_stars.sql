@@ -0,0 +1,37 @@
+-- Who starred what. A user can star a snippet once.
+CREATE TABLE stars (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    created TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, snippet_id)
+);
+
+CREATE INDEX idx_stars_snippet_id ON stars(snippet_id);
+
+-- Running totals, so pages never have to COUNT(*) the stars of every snippet
+-- they list. They are kept up to date by SnippetModel in the same transaction
+-- that changes the stars.
+CREATE TABLE snippet_stats (
+    snippet_id INTEGER PRIMARY KEY REFERENCES snippets(id) ON DELETE CASCADE,
+    stars INTEGER NOT NULL DEFAULT 0,
+    views INTEGER NOT NULL DEFAULT 0
+);
+
+-- The same counters per day, the popular listing only sums the last week.
+-- Unstarring decrements the day it happens, so a single day can go below zero,
+-- the sum over the week is still right.
+CREATE TABLE snippet_daily_stats (
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    stars INTEGER NOT NULL DEFAULT 0,
+    views INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (snippet_id, day)
+);
+
+CREATE INDEX idx_snippet_daily_stats_day ON snippet_daily_stats(day);
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE stars TO web;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE snippet_stats TO web;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE snippet_daily_stats TO web;
+
+INSERT INTO schema_migrations (version) VALUES (7);
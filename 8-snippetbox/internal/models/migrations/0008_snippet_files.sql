@@ -0,0 +1,31 @@
+-- A snippet is now made of one or more named files, each with its own
+-- language. The content and format of existing snippets become their first
+-- file. Languages aren't constrained here because the list is expected to grow,
+-- models.Languages is the list the application accepts.
+CREATE TABLE snippet_files (
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    language VARCHAR(20) NOT NULL,
+    content TEXT NOT NULL,
+    PRIMARY KEY (snippet_id, position),
+    CONSTRAINT snippet_files_snippet_id_name_key UNIQUE (snippet_id, name)
+);
+
+INSERT INTO snippet_files (snippet_id, position, name, language, content)
+SELECT id, 0,
+    CASE format WHEN 'markdown' THEN 'snippet.md' WHEN 'plain' THEN 'snippet.txt' ELSE 'snippet' END,
+    CASE format WHEN 'markdown' THEN 'markdown' WHEN 'plain' THEN 'text' ELSE 'code' END,
+    content
+FROM snippets;
+
+ALTER TABLE snippets DROP COLUMN content;
+ALTER TABLE snippets DROP COLUMN format;
+
+-- Comments anchored to lines now also say which file the lines are in, as
+-- the position of the file. Existing comments were about the only file there was.
+ALTER TABLE comments ADD COLUMN file INTEGER NOT NULL DEFAULT 0;
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE snippet_files TO web;
+
+INSERT INTO schema_migrations (version) VALUES (8);
@@ -0,0 +1,6 @@
+-- Snippets encrypted in the browser. The content of their files is ciphertext
+-- and the key never reaches the server, so they are left out of every listing
+-- that helps finding snippets.
+ALTER TABLE snippets ADD COLUMN encrypted BOOLEAN NOT NULL DEFAULT FALSE;
+
+INSERT INTO schema_migrations (version) VALUES (9);
@@ -0,0 +1,15 @@
+-- Token buckets of the Postgres rate limiter (internal/ratelimit), shared by
+-- every instance of the application. The key says what is limited and who for,
+-- like "snippet-create:user:42". Rows of buckets that are full again are
+-- deleted by the limiter, a missing row is the same as a full bucket.
+CREATE TABLE rate_limits (
+    key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_rate_limits_updated ON rate_limits(updated);
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE rate_limits TO web;
+
+INSERT INTO schema_migrations (version) VALUES (10);
@@ -0,0 +1,50 @@
+-- Moderators are made by hand, there is no page for it:
+--   UPDATE users SET moderator = true WHERE email = 'someone@example.com';
+-- Banned users can't log in anymore, and all their snippets are hidden.
+ALTER TABLE users ADD COLUMN moderator BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN banned BOOLEAN NOT NULL DEFAULT false;
+
+-- Hidden snippets are soft deleted, they are left out of every page but stay in
+-- the database so a mistake can be undone with:
+--   UPDATE snippets SET hidden = false WHERE id = 42;
+ALTER TABLE snippets ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT false;
+
+-- Reports are open until a moderator resolves them, the resolution says how.
+CREATE TABLE reports (
+    id SERIAL PRIMARY KEY,
+    snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason VARCHAR(20) NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    created TIMESTAMPTZ NOT NULL,
+    resolved TIMESTAMPTZ,
+    resolution VARCHAR(20),
+    CHECK ((resolved IS NULL) = (resolution IS NULL))
+);
+
+-- A user can only have one open report per snippet, reporting again does nothing
+CREATE UNIQUE INDEX idx_reports_open_user ON reports(snippet_id, user_id) WHERE resolved IS NULL;
+CREATE INDEX idx_reports_open_created ON reports(created) WHERE resolved IS NULL;
+
+-- Every moderation action, written in the same transaction as the action.
+-- There are no foreign keys on purpose: the log has to outlive the snippets,
+-- reports and users it talks about.
+CREATE TABLE moderation_log (
+    id SERIAL PRIMARY KEY,
+    moderator_id INTEGER NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    report_id INTEGER,
+    snippet_id INTEGER,
+    user_id INTEGER,
+    created TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_moderation_log_created ON moderation_log(created);
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE reports TO web;
+GRANT USAGE, SELECT ON SEQUENCE reports_id_seq TO web;
+-- the log is append only, the application can't change or delete what's in it
+GRANT SELECT, INSERT ON TABLE moderation_log TO web;
+GRANT USAGE, SELECT ON SEQUENCE moderation_log_id_seq TO web;
+
+INSERT INTO schema_migrations (version) VALUES (11);
@@ -0,0 +1,22 @@
+-- Security relevant things that happened to an account, like logins and
+-- signups, users can review their own on the account page. Failed logins for
+-- emails nobody signed up with have no user_id.
+-- Like moderation_log there are no foreign keys, the events have to outlive
+-- the users and snippets they are about.
+CREATE TABLE audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER,
+    event VARCHAR(30) NOT NULL,
+    snippet_id INTEGER,
+    ip VARCHAR(45) NOT NULL,
+    user_agent VARCHAR(512) NOT NULL,
+    created TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_audit_events_user_id_created ON audit_events(user_id, created);
+
+-- append only, the application can't change or delete what's in it
+GRANT SELECT, INSERT ON TABLE audit_events TO web;
+GRANT USAGE, SELECT ON SEQUENCE audit_events_id_seq TO web;
+
+INSERT INTO schema_migrations (version) VALUES (12);
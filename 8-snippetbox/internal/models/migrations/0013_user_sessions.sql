@@ -0,0 +1,21 @@
+-- The logged in sessions of every user. The sessions table belongs to scs and
+-- its data is an opaque blob, so it can't tell us whose sessions are whose.
+-- Each logged in session keeps the id of its row here in its data, the
+-- authenticate middleware logs out sessions whose row is gone, which is how a
+-- session is revoked. The id is random and is not the session token, knowing
+-- it doesn't give access to the session.
+CREATE TABLE user_sessions (
+    id CHAR(32) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ip VARCHAR(45) NOT NULL,
+    user_agent VARCHAR(512) NOT NULL,
+    created TIMESTAMPTZ NOT NULL,
+    last_seen TIMESTAMPTZ NOT NULL,
+    expires TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_user_sessions_user_id ON user_sessions(user_id);
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE user_sessions TO web;
+
+INSERT INTO schema_migrations (version) VALUES (13);
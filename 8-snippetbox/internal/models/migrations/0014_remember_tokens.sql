@@ -0,0 +1,25 @@
+-- Persistent logins for "remember me". The cookie holds the series and a
+-- token, only the SHA-256 of the token is stored, so a copy of this table can't
+-- be used to log in. The token changes every time it's used, the series stays
+-- the same for the life of the login. A known series with a wrong token means
+-- the cookie was copied and used by someone else, see RememberModel.Use.
+CREATE TABLE remember_tokens (
+    series CHAR(32) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash BYTEA NOT NULL,
+    -- the token before the last rotation, still accepted for a little while
+    previous_hash BYTEA,
+    created TIMESTAMPTZ NOT NULL,
+    rotated TIMESTAMPTZ NOT NULL,
+    expires TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_remember_tokens_user_id ON remember_tokens(user_id);
+
+-- The series a session was logged in with, revoking the session revokes the
+-- persistent login too, otherwise the cookie would just log it back in.
+ALTER TABLE user_sessions ADD COLUMN remember_series CHAR(32);
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE remember_tokens TO web;
+
+INSERT INTO schema_migrations (version) VALUES (14);
@@ -0,0 +1,5 @@
+-- The language a user picked on the account page, like 'pt-BR'.
+-- Empty means the browser decides, through its Accept-Language header.
+ALTER TABLE users ADD COLUMN locale VARCHAR(35) NOT NULL DEFAULT '';
+
+INSERT INTO schema_migrations (version) VALUES (15);
@@ -0,0 +1,5 @@
+-- The IANA time zone a user picked on the account page, like 'America/Sao_Paulo'.
+-- Empty means the one their browser reports is used.
+ALTER TABLE users ADD COLUMN time_zone VARCHAR(64) NOT NULL DEFAULT '';
+
+INSERT INTO schema_migrations (version) VALUES (16);
@@ -0,0 +1,52 @@
+-- URLs users want to be told about changes to their snippets at. The secret
+-- signs every delivery, see WebhookModel, so it has to be stored as it is.
+CREATE TABLE webhooks (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url VARCHAR(2048) NOT NULL,
+    secret CHAR(64) NOT NULL,
+    created TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_webhooks_user_id ON webhooks(user_id);
+
+-- The outbox: one row per event and webhook, written in the same transaction
+-- as the change the event is about, so an event is never lost or sent for a
+-- change that was rolled back. Rows stay after they were delivered, they are
+-- the delivery log of the webhooks page, until WebhookModel.Prune removes the
+-- old ones.
+-- state is pending until the webhook answered with a 2xx (delivered) or we
+-- gave up retrying (failed). next_attempt is when a pending delivery is due.
+CREATE TABLE webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event VARCHAR(30) NOT NULL,
+    -- the exact bytes that are signed and sent, every attempt sends the same
+    payload TEXT NOT NULL,
+    state VARCHAR(10) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt TIMESTAMPTZ NOT NULL,
+    -- what the last attempt got back, 0 when there was no response at all
+    response_status INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    created TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(next_attempt) WHERE state = 'pending';
+CREATE INDEX idx_webhook_deliveries_webhook_id_created ON webhook_deliveries(webhook_id, created);
+CREATE INDEX idx_webhook_deliveries_finished_created ON webhook_deliveries(created) WHERE state <> 'pending';
+
+-- Snippets expire by the clock, nothing happens in the database when they
+-- do. This remembers which expired snippets were already sent as an event.
+-- The ones that expired before webhooks existed don't need one.
+ALTER TABLE snippets ADD COLUMN expiry_announced BOOLEAN NOT NULL DEFAULT false;
+UPDATE snippets SET expiry_announced = true WHERE expires <= CURRENT_TIMESTAMP;
+
+CREATE INDEX idx_snippets_unannounced_expires ON snippets(expires) WHERE NOT expiry_announced;
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE webhooks TO web;
+GRANT USAGE, SELECT ON SEQUENCE webhooks_id_seq TO web;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE webhook_deliveries TO web;
+GRANT USAGE, SELECT ON SEQUENCE webhook_deliveries_id_seq TO web;
+
+INSERT INTO schema_migrations (version) VALUES (17);
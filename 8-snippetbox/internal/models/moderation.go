@@ -0,0 +1,231 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ReportReason is one of the categories a report can be filed under, the ID is what gets stored
+type ReportReason struct {
+	ID   string
+	Name string
+}
+
+// ReportReasons in the order they are offered in the report form
+var ReportReasons = []ReportReason{
+	{ID: "spam", Name: "Spam or advertising"},
+	{ID: "abuse", Name: "Harassment or hateful content"},
+	{ID: "secrets", Name: "Leaked credentials or personal data"},
+	{ID: "malware", Name: "Malware or phishing"},
+	{ID: "other", Name: "Something else"},
+}
+
+func IsReportReason(id string) bool {
+	return slices.ContainsFunc(ReportReasons, func(reason ReportReason) bool {
+		return reason.ID == id
+	})
+}
+
+// What a moderator did, stored as the resolution of reports and as the action in the log
+const (
+	ModerationDismiss = "dismiss"
+	ModerationHide    = "hide"
+	ModerationBan     = "ban"
+)
+
+// An open report, with the names of the people involved for the moderation queue
+type Report struct {
+	ID           int
+	SnippetID    int
+	SnippetTitle string
+	// The author of the reported snippet, 0 for snippets from before snippets had owners
+	AuthorID   int
+	AuthorName string
+	// Who filed the report
+	UserID   int
+	UserName string
+	Reason   string
+	Details  string
+	Created  time.Time
+}
+
+// An entry of the moderation log. Nothing in the log is a foreign key, so the IDs can point at things that were deleted since, and the names are empty then.
+type ModerationAction struct {
+	ID            int
+	ModeratorID   int
+	ModeratorName string
+	Action        string
+	ReportID      int
+	SnippetID     int
+	UserID        int
+	UserName      string
+	Created       time.Time
+}
+
+/*
+ModerationModel files reports and carries out what moderators decide about them.
+
+Every decision is made in a transaction that also writes it to the moderation_log table, so there is never an action without its log entry or the other way around. A report can only be resolved once: the report is locked with FOR UPDATE first, and ErrNoRecord is returned when it was already resolved, like when two moderators act on the same report at the same time.
+*/
+type ModerationModel struct {
+	DB *pgxpool.Pool
+}
+
+// Report files a report about a snippet. A user with an open report on the snippet already is ignored, there is no point in having the same report twice in the queue.
+func (m *ModerationModel) Report(ctx context.Context, snippetID, userID int, reason, details string) error {
+	statement := `INSERT INTO reports (snippet_id, user_id, reason, details, created) VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+  ON CONFLICT (snippet_id, user_id) WHERE resolved IS NULL DO NOTHING`
+
+	_, err := m.DB.Exec(ctx, statement, snippetID, userID, reason, details)
+
+	return err
+}
+
+// OpenReports returns the reports waiting for a moderator, the oldest first. Reports about snippets that expired since are left out, there is nothing to act on anymore.
+func (m *ModerationModel) OpenReports(ctx context.Context) ([]Report, error) {
+	statement := `SELECT r.id, r.snippet_id, s.title AS snippet_title, COALESCE(s.user_id, 0) AS author_id, COALESCE(a.name, '') AS author_name,
+    r.user_id, u.name AS user_name, r.reason, r.details, r.created
+  FROM reports r
+  JOIN snippets s ON s.id = r.snippet_id
+  LEFT JOIN users a ON a.id = s.user_id
+  JOIN users u ON u.id = r.user_id
+  WHERE r.resolved IS NULL AND s.expires > CURRENT_TIMESTAMP
+  ORDER BY r.created, r.id LIMIT 100`
+
+	rows, _ := m.DB.Query(ctx, statement)
+	reports, err := pgx.CollectRows(rows, pgx.RowToStructByName[Report])
+	if err != nil {
+		return nil, err
+	}
+
+	return reports, nil
+}
+
+// Dismiss closes a report without doing anything to the snippet
+func (m *ModerationModel) Dismiss(ctx context.Context, moderatorID, reportID int) error {
+	return m.resolve(ctx, moderatorID, reportID, ModerationDismiss, func(tx pgx.Tx, snippetID, authorID int) (int, error) {
+		_, err := tx.Exec(ctx, `UPDATE reports SET resolved = CURRENT_TIMESTAMP, resolution = $2 WHERE id = $1`, reportID, ModerationDismiss)
+
+		return 0, err
+	})
+}
+
+// Hide hides the reported snippet, which closes every open report about it
+func (m *ModerationModel) Hide(ctx context.Context, moderatorID, reportID int) error {
+	return m.resolve(ctx, moderatorID, reportID, ModerationHide, func(tx pgx.Tx, snippetID, authorID int) (int, error) {
+		_, err := tx.Exec(ctx, `UPDATE snippets SET hidden = true WHERE id = $1`, snippetID)
+		if err != nil {
+			return 0, err
+		}
+
+		err = enqueueWebhooks(ctx, tx, WebhookSnippetHidden, snippetID)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE reports SET resolved = CURRENT_TIMESTAMP, resolution = $2 WHERE snippet_id = $1 AND resolved IS NULL`, snippetID, ModerationHide)
+
+		return 0, err
+	})
+}
+
+// Ban bans the author of the reported snippet and hides all of their snippets, which closes every open report about them. Moderators can't be banned, and neither can snippets without an author, both return ErrNoRecord.
+func (m *ModerationModel) Ban(ctx context.Context, moderatorID, reportID int) error {
+	return m.resolve(ctx, moderatorID, reportID, ModerationBan, func(tx pgx.Tx, snippetID, authorID int) (int, error) {
+		tag, err := tx.Exec(ctx, `UPDATE users SET banned = true WHERE id = $1 AND NOT moderator`, authorID)
+		if err != nil {
+			return 0, err
+		}
+
+		if tag.RowsAffected() == 0 {
+			return 0, ErrNoRecord
+		}
+
+		// banned users can't log in anymore, so there is no point in keeping their sessions and persistent logins around
+		_, err = tx.Exec(ctx, `DELETE FROM remember_tokens WHERE user_id = $1`, authorID)
+		if err != nil {
+			return 0, err
+		}
+
+		// nor in telling them about their snippets, their webhooks go with everything still waiting in the outbox
+		_, err = tx.Exec(ctx, `DELETE FROM webhooks WHERE user_id = $1`, authorID)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.Exec(ctx, `DELETE FROM user_sessions WHERE user_id = $1`, authorID)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE snippets SET hidden = true WHERE user_id = $1`, authorID)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE reports SET resolved = CURRENT_TIMESTAMP, resolution = $2
+  WHERE resolved IS NULL AND snippet_id IN (SELECT id FROM snippets WHERE user_id = $1)`, authorID, ModerationBan)
+
+		return authorID, err
+	})
+}
+
+// resolve locks an open report, runs act on it and logs the action, all in one transaction. act returns the ID of the user the action was about, 0 when it was only about the snippet.
+func (m *ModerationModel) resolve(ctx context.Context, moderatorID, reportID int, action string, act func(tx pgx.Tx, snippetID, authorID int) (int, error)) error {
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var snippetID, authorID int
+
+	statement := `SELECT r.snippet_id, COALESCE(s.user_id, 0) FROM reports r JOIN snippets s ON s.id = r.snippet_id
+  WHERE r.id = $1 AND r.resolved IS NULL FOR UPDATE OF r`
+
+	err = tx.QueryRow(ctx, statement, reportID).Scan(&snippetID, &authorID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNoRecord
+		}
+
+		return err
+	}
+
+	userID, err := act(tx, snippetID, authorID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO moderation_log (moderator_id, action, report_id, snippet_id, user_id, created)
+  VALUES ($1, $2, $3, $4, NULLIF($5, 0), CURRENT_TIMESTAMP)`, moderatorID, action, reportID, snippetID, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Log returns the latest moderation actions, the most recent first
+func (m *ModerationModel) Log(ctx context.Context, limit int) ([]ModerationAction, error) {
+	statement := `SELECT l.id, l.moderator_id, COALESCE(mo.name, '') AS moderator_name, l.action,
+    COALESCE(l.report_id, 0) AS report_id, COALESCE(l.snippet_id, 0) AS snippet_id,
+    COALESCE(l.user_id, 0) AS user_id, COALESCE(u.name, '') AS user_name, l.created
+  FROM moderation_log l
+  LEFT JOIN users mo ON mo.id = l.moderator_id
+  LEFT JOIN users u ON u.id = l.user_id
+  ORDER BY l.created DESC, l.id DESC LIMIT $1`
+
+	rows, _ := m.DB.Query(ctx, statement, limit)
+	actions, err := pgx.CollectRows(rows, pgx.RowToStructByName[ModerationAction])
+	if err != nil {
+		return nil, err
+	}
+
+	return actions, nil
+}
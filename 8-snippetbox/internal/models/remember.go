@@ -0,0 +1,130 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// How long the token before the last rotation keeps working. A browser that sends a few requests at once with the same cookie would otherwise look exactly like a stolen cookie, only the first one gets the new token.
+const rememberGracePeriod = 30 * time.Second
+
+/*
+RememberModel stores the persistent logins of "remember me", following the series and token pattern from https://www.jaspan.com/improved_persistent_login_cookie_best_practice
+
+  - the cookie holds a series, which identifies the login, and a token, which changes every time the cookie is used
+  - when the series is known but the token isn't the current one, someone used a copy of the cookie and got the new token first, so we can't tell who is who anymore. Every persistent login and session of the user is revoked, the thief gets logged out with them.
+*/
+type RememberModel struct {
+	DB *pgxpool.Pool
+}
+
+func hashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// Create starts a persistent login for userID lasting lifetime, and returns the series and the first token for the cookie
+func (m *RememberModel) Create(ctx context.Context, userID int, lifetime time.Duration) (series, token string, err error) {
+	series, token = randomHex(16), randomHex(32)
+
+	statement := `INSERT INTO remember_tokens (series, user_id, token_hash, created, rotated, expires)
+  VALUES ($1, $2, $3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP + make_interval(secs => $4))`
+
+	_, err = m.DB.Exec(ctx, statement, series, userID, hashToken(token), lifetime.Seconds())
+	if err != nil {
+		return "", "", err
+	}
+
+	return series, token, nil
+}
+
+/*
+Use logs in with the series and token from a cookie. It returns the user and the next token to put in the cookie, or an empty token when the previous one was used within the grace period, the browser got the new one already.
+
+It returns ErrNoRecord when the series doesn't exist or expired, and ErrStolenToken, together with the user, when the token doesn't match.
+*/
+func (m *RememberModel) Use(ctx context.Context, series, token string) (int, string, error) {
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		userID            int
+		current, previous []byte
+		expired, inGrace  bool
+	)
+
+	statement := `SELECT user_id, token_hash, previous_hash, expires <= CURRENT_TIMESTAMP,
+    rotated > CURRENT_TIMESTAMP - make_interval(secs => $2)
+  FROM remember_tokens WHERE series = $1 FOR UPDATE`
+
+	err = tx.QueryRow(ctx, statement, series, rememberGracePeriod.Seconds()).Scan(&userID, &current, &previous, &expired, &inGrace)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, "", ErrNoRecord
+		}
+
+		return 0, "", err
+	}
+
+	hash := hashToken(token)
+
+	switch {
+	case expired:
+		_, err = tx.Exec(ctx, `DELETE FROM remember_tokens WHERE series = $1`, series)
+		if err != nil {
+			return 0, "", err
+		}
+
+		err = tx.Commit(ctx)
+		if err != nil {
+			return 0, "", err
+		}
+
+		return 0, "", ErrNoRecord
+	case subtle.ConstantTimeCompare(hash, current) == 1:
+		next := randomHex(32)
+
+		_, err = tx.Exec(ctx, `UPDATE remember_tokens SET token_hash = $2, previous_hash = $3, rotated = CURRENT_TIMESTAMP WHERE series = $1`, series, hashToken(next), current)
+		if err != nil {
+			return 0, "", err
+		}
+
+		return userID, next, tx.Commit(ctx)
+	case inGrace && subtle.ConstantTimeCompare(hash, previous) == 1:
+		return userID, "", nil
+	}
+
+	// nobody but the owner of the cookie and the thief could know the series, revoke everything and let the owner log in again with their password
+	_, err = tx.Exec(ctx, `DELETE FROM remember_tokens WHERE user_id = $1`, userID)
+	if err != nil {
+		return 0, "", err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM user_sessions WHERE user_id = $1`, userID)
+	if err != nil {
+		return 0, "", err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return userID, "", ErrStolenToken
+}
+
+// Delete ends a persistent login
+func (m *RememberModel) Delete(ctx context.Context, series string) error {
+	_, err := m.DB.Exec(ctx, `DELETE FROM remember_tokens WHERE series = $1`, series)
+
+	return err
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRememberModelUse(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	remember := &RememberModel{DB: db}
+	sessions := &SessionModel{DB: db}
+
+	userID := newTestUser(t, db)
+
+	// use logs in with series and token and expects it to work
+	use := func(t *testing.T, series, token string) string {
+		t.Helper()
+
+		gotUserID, next, err := remember.Use(ctx, series, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gotUserID != userID {
+			t.Fatalf("got user %d; want %d", gotUserID, userID)
+		}
+
+		return next
+	}
+
+	t.Run("Rotates the token", func(t *testing.T) {
+		series, first, err := remember.Create(ctx, userID, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		second := use(t, series, first)
+		if second == "" || second == first {
+			t.Fatalf("got next token %q after %q, want a new one", second, first)
+		}
+
+		third := use(t, series, second)
+		if third == "" || third == second {
+			t.Fatalf("got next token %q after %q, want a new one", third, second)
+		}
+	})
+
+	t.Run("Previous token within the grace period", func(t *testing.T) {
+		series, first, err := remember.Create(ctx, userID, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		second := use(t, series, first)
+
+		// a request that left with the old cookie before the new one arrived
+		if next := use(t, series, first); next != "" {
+			t.Errorf("got next token %q for the previous token, want none", next)
+		}
+
+		// and the new token still works after that
+		use(t, series, second)
+	})
+
+	t.Run("Previous token after the grace period", func(t *testing.T) {
+		series, first, err := remember.Create(ctx, userID, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		second := use(t, series, first)
+
+		_, err = db.Exec(ctx, `UPDATE remember_tokens SET rotated = rotated - make_interval(secs => $2) WHERE series = $1`, series, (2 * rememberGracePeriod).Seconds())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sessionID, err := sessions.Create(ctx, userID, series, "192.0.2.1", "test", time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotUserID, _, err := remember.Use(ctx, series, first)
+		if !errors.Is(err, ErrStolenToken) {
+			t.Fatalf("got error %v; want %v", err, ErrStolenToken)
+		}
+		if gotUserID != userID {
+			t.Errorf("got user %d with the stolen token; want %d", gotUserID, userID)
+		}
+
+		// the owner is logged out too, there's no telling who is who anymore
+		_, _, err = remember.Use(ctx, series, second)
+		if !errors.Is(err, ErrNoRecord) {
+			t.Errorf("got error %v for the current token after the theft; want %v", err, ErrNoRecord)
+		}
+
+		ok, err := sessions.Touch(ctx, sessionID, userID, "192.0.2.1", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			t.Error("the session survived the theft")
+		}
+	})
+
+	t.Run("Wrong token", func(t *testing.T) {
+		series, _, err := remember.Create(ctx, userID, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = remember.Use(ctx, series, "not the token")
+		if !errors.Is(err, ErrStolenToken) {
+			t.Errorf("got error %v; want %v", err, ErrStolenToken)
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		series, token, err := remember.Create(ctx, userID, -time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = remember.Use(ctx, series, token)
+		if !errors.Is(err, ErrNoRecord) {
+			t.Errorf("got error %v; want %v", err, ErrNoRecord)
+		}
+	})
+
+	t.Run("Unknown series", func(t *testing.T) {
+		_, _, err := remember.Use(ctx, randomHex(16), "token")
+		if !errors.Is(err, ErrNoRecord) {
+			t.Errorf("got error %v; want %v", err, ErrNoRecord)
+		}
+	})
+}
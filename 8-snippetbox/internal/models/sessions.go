@@ -0,0 +1,148 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// UserSession describes a logged in session, for the user to recognize it on the account page
+type UserSession struct {
+	ID        string
+	UserID    int
+	IP        string
+	UserAgent string
+	Created   time.Time
+	LastSeen  time.Time
+	Expires   time.Time
+}
+
+// last_seen is only written when it's older than this, otherwise every request would be a write
+const sessionTouchInterval = time.Minute
+
+// SessionModel keeps track of the logged in sessions of users, see the 0013_user_sessions.sql migration for how it relates to the sessions of scs
+type SessionModel struct {
+	DB *pgxpool.Pool
+}
+
+// randomHex returns n random bytes, hex encoded, for IDs and tokens nobody should be able to guess
+func randomHex(n int) string {
+	b := make([]byte, n)
+	// crypto/rand.Read never returns an error on the platforms we support, see https://pkg.go.dev/crypto/rand#Read
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// Create stores a new session for userID and returns its ID. rememberSeries is the persistent login the session was started with, empty when there isn't one. The expired sessions of the user are cleaned up on the way, it's as good a time as any.
+func (m *SessionModel) Create(ctx context.Context, userID int, rememberSeries, ip, userAgent string, expires time.Time) (string, error) {
+	id := randomHex(16)
+
+	_, err := m.DB.Exec(ctx, `DELETE FROM user_sessions WHERE user_id = $1 AND expires <= CURRENT_TIMESTAMP`, userID)
+	if err != nil {
+		return "", err
+	}
+
+	statement := `INSERT INTO user_sessions (id, user_id, remember_series, ip, user_agent, created, last_seen, expires)
+  VALUES ($1, $2, NULLIF($3, ''), $4, $5, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, $6)`
+
+	_, err = m.DB.Exec(ctx, statement, id, userID, rememberSeries, ip, userAgent, expires)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// Touch reports whether the session id of userID is still active, and records that it was just seen from ip with userAgent
+func (m *SessionModel) Touch(ctx context.Context, id string, userID int, ip, userAgent string) (bool, error) {
+	var lastSeen time.Time
+
+	statement := `SELECT last_seen FROM user_sessions WHERE id = $1 AND user_id = $2 AND expires > CURRENT_TIMESTAMP`
+
+	err := m.DB.QueryRow(ctx, statement, id, userID).Scan(&lastSeen)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	if time.Since(lastSeen) < sessionTouchInterval {
+		return true, nil
+	}
+
+	_, err = m.DB.Exec(ctx, `UPDATE user_sessions SET last_seen = CURRENT_TIMESTAMP, ip = $2, user_agent = $3 WHERE id = $1`, id, ip, userAgent)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ForUser returns the active sessions of a user, the last seen first
+func (m *SessionModel) ForUser(ctx context.Context, userID int) ([]UserSession, error) {
+	statement := `SELECT id, user_id, ip, user_agent, created, last_seen, expires FROM user_sessions
+  WHERE user_id = $1 AND expires > CURRENT_TIMESTAMP ORDER BY last_seen DESC`
+
+	rows, _ := m.DB.Query(ctx, statement, userID)
+	sessions, err := pgx.CollectRows(rows, pgx.RowToStructByName[UserSession])
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Delete revokes a session of userID, sessions of other users are left alone. The persistent login the session was started with is revoked too, or its cookie would just start a new session.
+// It returns ErrNoRecord when there was no such session, because it was already revoked or isn't theirs.
+func (m *SessionModel) Delete(ctx context.Context, id string, userID int) error {
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `DELETE FROM remember_tokens WHERE series = (SELECT remember_series FROM user_sessions WHERE id = $1 AND user_id = $2)`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, `DELETE FROM user_sessions WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DeleteAll revokes every session and persistent login of userID
+func (m *SessionModel) DeleteAll(ctx context.Context, userID int) error {
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `DELETE FROM remember_tokens WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM user_sessions WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -11,29 +11,104 @@ import (
 
 // Define a Snippet type to hold the data for an individual snippet. Notice how the fields of the struct correspond to the fields in the database
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
+	ID     int
+	UserID int
+	Title  string
+	// Always at least one, in the order they were added
+	Files   []SnippetFile
+	Tags    []string
+	Private bool
+	// The content of the files is ciphertext, only browsers with the key from the link can read it
+	Encrypted bool
+	// The ID of the snippet this one was forked from, 0 when it isn't a fork
+	ForkedFromID int
+	// All time totals, read from snippet_stats
+	Stars   int
+	Views   int
 	Created time.Time
 	Expires time.Time
 }
 
+// A named file of a snippet, the json tags are the keys of the objects built by the files subquery of snippetColumns
+type SnippetFile struct {
+	Name     string `json:"name"`
+	Language string `json:"language"`
+	Content  string `json:"content"`
+}
+
+// TagMatch controls how ByTags combines more than one tag
+type TagMatch int
+
+const (
+	// MatchAny returns snippets with at least one of the tags (OR)
+	MatchAny TagMatch = iota
+	// MatchAll returns snippets with every one of the tags (AND)
+	MatchAll
+)
+
+// The columns every snippet query selects, in the order of the Snippet fields. Tags live in another table, so they are collected into an array with a subquery, which pgx scans straight into a []string.
+// Files are collected the same way, but a row has more than one column, so each file is turned into a JSON object and pgx unmarshals the JSON array into a []SnippetFile.
+// Snippets created before users owned them have no user_id, COALESCE turns that into 0, which is never a valid user ID.
+// The counters are a lookup by primary key in snippet_stats, snippets nobody starred or viewed yet don't have a row there.
+const snippetColumns = `s.id, COALESCE(s.user_id, 0) AS user_id, s.title,
+  (SELECT COALESCE(json_agg(json_build_object('name', f.name, 'language', f.language, 'content', f.content) ORDER BY f.position), '[]')
+    FROM snippet_files f WHERE f.snippet_id = s.id) AS files,
+  ARRAY(SELECT t.name FROM snippet_tags st JOIN tags t ON t.id = st.tag_id WHERE st.snippet_id = s.id ORDER BY t.name) AS tags,
+  s.private, s.encrypted, COALESCE(s.forked_from_id, 0) AS forked_from_id,
+  COALESCE((SELECT ss.stars FROM snippet_stats ss WHERE ss.snippet_id = s.id), 0) AS stars,
+  COALESCE((SELECT ss.views FROM snippet_stats ss WHERE ss.snippet_id = s.id), 0) AS views,
+  s.created, s.expires`
+
 // The snippet model will be responsible for interacting with the DB, like inserting, updating, deleting, etc
+// Every method takes the context of the request it is serving, so queries are cancelled when the client goes away and show up as children of the request in traces.
 type SnippetModel struct {
-	DB  *pgxpool.Pool
-	CTX context.Context
+	DB *pgxpool.Pool
 }
 
-func (m *SnippetModel) Insert(title, content string, expires time.Time) (int, error) {
+// Insert stores a new snippet and returns its ID. The ID and Created fields of snippet are ignored, the database sets them.
+func (m *SnippetModel) Insert(ctx context.Context, snippet Snippet) (int, error) {
+	// The snippet and its tags are written in a transaction, so we never end up with a snippet that silently lost its tags
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	// Rollback is a no-op once the transaction has been committed, so deferring it is the easiest way to undo everything on any early return
+	defer tx.Rollback(ctx)
+
 	// using blockquotes for readability, so we can break the lines
 	// we use RETURNING to get the newly added ID
-	statement := `INSERT INTO snippets (title, content, created, expires)
-  VALUES ($1, $2, CURRENT_TIMESTAMP, $3) RETURNING id`
+	statement := `INSERT INTO snippets (user_id, title, private, encrypted, forked_from_id, created, expires)
+  VALUES (NULLIF($1, 0), $2, $3, $4, NULLIF($5, 0), CURRENT_TIMESTAMP, $6) RETURNING id`
 
 	var newId int
 
 	// notice that instead of .Exec() we use .QueryRow() because we are using RETURNING
-	err := m.DB.QueryRow(m.CTX, statement, title, content, expires).Scan(&newId)
+	err = tx.QueryRow(ctx, statement, snippet.UserID, snippet.Title, snippet.Private, snippet.Encrypted, snippet.ForkedFromID, snippet.Expires).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	// the position keeps the files in the order they were in the form
+	for position, file := range snippet.Files {
+		_, err = tx.Exec(ctx, `INSERT INTO snippet_files (snippet_id, position, name, language, content) VALUES ($1, $2, $3, $4, $5)`,
+			newId, position, file.Name, file.Language, file.Content)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = setTags(ctx, tx, newId, snippet.Tags)
+	if err != nil {
+		return 0, err
+	}
+
+	// in the same transaction, so the webhooks of the author hear about every snippet that was created and none that wasn't
+	err = enqueueWebhooks(ctx, tx, WebhookSnippetCreated, newId)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit(ctx)
 	if err != nil {
 		return 0, err
 	}
@@ -41,10 +116,29 @@ func (m *SnippetModel) Insert(title, content string, expires time.Time) (int, er
 	return newId, nil
 }
 
-func (m *SnippetModel) Get(id int) (Snippet, error) {
-	statement := `SELECT id, title, content, created, expires FROM snippets WHERE expires > CURRENT_TIMESTAMP AND id = $1`
+// setTags links a snippet to tags by name, creating the tags that don't exist yet
+func setTags(ctx context.Context, tx pgx.Tx, snippetId int, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
 
-	rows, _ := m.DB.Query(m.CTX, statement, id)
+	// unnest turns the array parameter into rows, so every tag is inserted with a single statement
+	_, err := tx.Exec(ctx, `INSERT INTO tags (name) SELECT unnest($1::text[]) ON CONFLICT (name) DO NOTHING`, tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO snippet_tags (snippet_id, tag_id)
+  SELECT $1, id FROM tags WHERE name = ANY($2) ON CONFLICT DO NOTHING`, snippetId, tags)
+
+	return err
+}
+
+// Get returns a snippet whether it's private or not, checking if the current user is allowed to see it is up to the caller. Snippets hidden by a moderator are gone for everyone, like every other query they are treated as if they didn't exist.
+func (m *SnippetModel) Get(ctx context.Context, id int) (Snippet, error) {
+	statement := `SELECT ` + snippetColumns + ` FROM snippets s WHERE s.expires > CURRENT_TIMESTAMP AND NOT s.hidden AND s.id = $1`
+
+	rows, _ := m.DB.Query(ctx, statement, id)
 	snippet, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[Snippet])
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -58,11 +152,88 @@ func (m *SnippetModel) Get(id int) (Snippet, error) {
 	return snippet, nil
 }
 
-func (m *SnippetModel) Latest() ([]Snippet, error) {
-	statement := `SELECT id, title, content, created, expires from snippets
-  WHERE expires > CURRENT_TIMESTAMP ORDER BY id DESC limit 10`
+// Latest returns the 10 most recent public snippets. Encrypted snippets are left out, like in every other listing, they are only meant for the people who got the link with the key.
+func (m *SnippetModel) Latest(ctx context.Context) ([]Snippet, error) {
+	statement := `SELECT ` + snippetColumns + ` FROM snippets s
+  WHERE s.expires > CURRENT_TIMESTAMP AND NOT s.hidden AND NOT s.private AND NOT s.encrypted ORDER BY s.id DESC limit 10`
+
+	rows, _ := m.DB.Query(ctx, statement)
+	snippets, err := pgx.CollectRows(rows, pgx.RowToStructByName[Snippet])
+	if err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// LatestBy returns the latest public, unencrypted snippets of one user, like Latest does for everybody
+func (m *SnippetModel) LatestBy(ctx context.Context, userID int) ([]Snippet, error) {
+	statement := `SELECT ` + snippetColumns + ` FROM snippets s
+  WHERE s.user_id = $1 AND s.expires > CURRENT_TIMESTAMP AND NOT s.hidden AND NOT s.private AND NOT s.encrypted ORDER BY s.id DESC limit 10`
+
+	rows, _ := m.DB.Query(ctx, statement, userID)
+	snippets, err := pgx.CollectRows(rows, pgx.RowToStructByName[Snippet])
+	if err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// A snippet in a list, with only what it takes to tell whether the list changed, see LatestVersions
+type SnippetVersion struct {
+	ID      int
+	Created time.Time
+}
+
+/*
+LatestVersions returns what Latest would return, or LatestBy when userID isn't 0, without the files and tags. Those take a subquery per snippet, while this is a walk down the primary key, so feeds use it to find out whether anything changed before building the whole list.
+
+Snippets can't be edited, so the IDs are enough: the list only changes when a snippet is created, or one drops out of it because it expired or was hidden.
+*/
+func (m *SnippetModel) LatestVersions(ctx context.Context, userID int) ([]SnippetVersion, error) {
+	statement := `SELECT s.id, s.created FROM snippets s
+  WHERE ($1 = 0 OR s.user_id = $1) AND s.expires > CURRENT_TIMESTAMP AND NOT s.hidden AND NOT s.private AND NOT s.encrypted ORDER BY s.id DESC limit 10`
+
+	rows, _ := m.DB.Query(ctx, statement, userID)
+	versions, err := pgx.CollectRows(rows, pgx.RowToStructByName[SnippetVersion])
+	if err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// ByTags returns the latest public, unencrypted snippets tagged with any (MatchAny) or all (MatchAll) of the given tags. The tags must be unique, which is what ParseTags guarantees.
+func (m *SnippetModel) ByTags(ctx context.Context, tags []string, match TagMatch) ([]Snippet, error) {
+	// For MatchAll we count how many of the requested tags each snippet has, and only keep the ones that have all of them
+	having := ""
+	if match == MatchAll {
+		having = `HAVING COUNT(*) = cardinality($1::text[])`
+	}
+
+	statement := `SELECT ` + snippetColumns + ` FROM snippets s
+  WHERE s.expires > CURRENT_TIMESTAMP AND NOT s.hidden AND NOT s.private AND NOT s.encrypted AND s.id IN (
+    SELECT st.snippet_id FROM snippet_tags st JOIN tags t ON t.id = st.tag_id
+    WHERE t.name = ANY($1) GROUP BY st.snippet_id ` + having + `
+  ) ORDER BY s.id DESC LIMIT 50`
+
+	rows, _ := m.DB.Query(ctx, statement, tags)
+	snippets, err := pgx.CollectRows(rows, pgx.RowToStructByName[Snippet])
+	if err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// Forks returns the unencrypted snippets forked from a snippet that userID is allowed to list: the public ones, and their own private ones
+func (m *SnippetModel) Forks(ctx context.Context, id, userID int) ([]Snippet, error) {
+	statement := `SELECT ` + snippetColumns + ` FROM snippets s
+  WHERE s.forked_from_id = $1 AND s.expires > CURRENT_TIMESTAMP AND NOT s.hidden AND NOT s.encrypted AND (NOT s.private OR s.user_id = $2)
+  ORDER BY s.id DESC LIMIT 50`
 
-	rows, _ := m.DB.Query(m.CTX, statement)
+	rows, _ := m.DB.Query(ctx, statement, id, userID)
 	snippets, err := pgx.CollectRows(rows, pgx.RowToStructByName[Snippet])
 	if err != nil {
 		return nil, err
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+/*
+Stars and views are counted in two tables instead of running COUNT(*) on stars every time a list of snippets is displayed:
+
+  - snippet_stats holds the all time totals, one row per snippet, read with a primary key lookup by snippetColumns
+  - snippet_daily_stats holds the same counters per day, so "popular this week" only has to sum 7 rows per snippet, found through the index on day
+
+Stars are counted in the same transaction as the change to the stars table, so the two can't drift apart. Views are batched in memory by the web server and written every few seconds with RecordViews, one transaction per batch instead of one per page view.
+*/
+
+// How much a star is worth compared to a view when ranking popular snippets, starring is a deliberate action while a view can be anything
+const starWeight = 10
+
+// Star adds a star from userID, starring a snippet twice does nothing
+func (m *SnippetModel) Star(ctx context.Context, id, userID int) error {
+	return m.setStar(ctx, id, userID, true)
+}
+
+// Unstar removes the star from userID, if there was one
+func (m *SnippetModel) Unstar(ctx context.Context, id, userID int) error {
+	return m.setStar(ctx, id, userID, false)
+}
+
+func (m *SnippetModel) setStar(ctx context.Context, id, userID int, starred bool) error {
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var tag pgconn.CommandTag
+	delta := 1
+
+	if starred {
+		tag, err = tx.Exec(ctx, `INSERT INTO stars (user_id, snippet_id, created) VALUES ($1, $2, CURRENT_TIMESTAMP) ON CONFLICT DO NOTHING`, userID, id)
+	} else {
+		tag, err = tx.Exec(ctx, `DELETE FROM stars WHERE user_id = $1 AND snippet_id = $2`, userID, id)
+		delta = -1
+	}
+	if err != nil {
+		return err
+	}
+
+	// starring twice, or unstarring something that wasn't starred, didn't change anything, so the counters must not change either
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	err = addStats(ctx, tx, id, delta, 0)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+/*
+RecordViews adds views to the counters, views maps snippet IDs to how many times they were viewed. They're collected in memory and written in batches (see cmd/web/views.go), a transaction per view would have every page view of a popular snippet wait on the lock of its snippet_stats row.
+
+The rows are updated in the order of the snippet IDs, so two instances writing their batches at the same time take the locks in the same order and can't deadlock.
+*/
+func (m *SnippetModel) RecordViews(ctx context.Context, views map[int]int) error {
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, id := range slices.Sorted(maps.Keys(views)) {
+		err = addStats(ctx, tx, id, 0, views[id])
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// addStats adds to the counters of a snippet, creating the rows of the snippet and of today when they don't exist yet
+func addStats(ctx context.Context, tx pgx.Tx, snippetID, stars, views int) error {
+	_, err := tx.Exec(ctx, `INSERT INTO snippet_stats (snippet_id, stars, views) VALUES ($1, $2, $3)
+  ON CONFLICT (snippet_id) DO UPDATE SET stars = snippet_stats.stars + EXCLUDED.stars, views = snippet_stats.views + EXCLUDED.views`,
+		snippetID, stars, views)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO snippet_daily_stats (snippet_id, day, stars, views) VALUES ($1, CURRENT_DATE, $2, $3)
+  ON CONFLICT (snippet_id, day) DO UPDATE SET stars = snippet_daily_stats.stars + EXCLUDED.stars, views = snippet_daily_stats.views + EXCLUDED.views`,
+		snippetID, stars, views)
+
+	return err
+}
+
+// Starred reports if userID starred a snippet
+func (m *SnippetModel) Starred(ctx context.Context, id, userID int) (bool, error) {
+	var starred bool
+
+	err := m.DB.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM stars WHERE user_id = $1 AND snippet_id = $2)`, userID, id).Scan(&starred)
+
+	return starred, err
+}
+
+// StarredBy returns the snippets userID starred that haven't expired, the last starred first. Private snippets are included, the caller has to check the user can still see them.
+func (m *SnippetModel) StarredBy(ctx context.Context, userID int) ([]Snippet, error) {
+	statement := `SELECT ` + snippetColumns + ` FROM snippets s
+  JOIN stars st ON st.snippet_id = s.id
+  WHERE st.user_id = $1 AND s.expires > CURRENT_TIMESTAMP AND NOT s.hidden
+  ORDER BY st.created DESC LIMIT 100`
+
+	rows, _ := m.DB.Query(ctx, statement, userID)
+	snippets, err := pgx.CollectRows(rows, pgx.RowToStructByName[Snippet])
+	if err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// Popular returns the public, unencrypted snippets with the most stars and views in the last 7 days, today included
+func (m *SnippetModel) Popular(ctx context.Context, limit int) ([]Snippet, error) {
+	statement := `SELECT ` + snippetColumns + ` FROM snippets s
+  JOIN (
+    SELECT snippet_id, SUM(stars) * $2 + SUM(views) AS score FROM snippet_daily_stats
+    WHERE day > CURRENT_DATE - 7 GROUP BY snippet_id
+  ) p ON p.snippet_id = s.id
+  WHERE s.expires > CURRENT_TIMESTAMP AND NOT s.hidden AND NOT s.private AND NOT s.encrypted AND p.score > 0
+  ORDER BY p.score DESC, s.id DESC LIMIT $1`
+
+	rows, _ := m.DB.Query(ctx, statement, limit, starWeight)
+	snippets, err := pgx.CollectRows(rows, pgx.RowToStructByName[Snippet])
+	if err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
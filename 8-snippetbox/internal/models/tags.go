@@ -0,0 +1,52 @@
+package models
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TagCount struct {
+	Name  string
+	Count int
+}
+
+type TagModel struct {
+	DB *pgxpool.Pool
+}
+
+// Counts returns the most used tags, counting only public, unencrypted snippets that haven't expired yet
+func (m *TagModel) Counts(ctx context.Context, limit int) ([]TagCount, error) {
+	statement := `SELECT t.name, COUNT(*) AS count FROM tags t
+  JOIN snippet_tags st ON st.tag_id = t.id
+  JOIN snippets s ON s.id = st.snippet_id
+  WHERE s.expires > CURRENT_TIMESTAMP AND NOT s.hidden AND NOT s.private AND NOT s.encrypted
+  GROUP BY t.name ORDER BY count DESC, t.name LIMIT $1`
+
+	rows, _ := m.DB.Query(ctx, statement, limit)
+	counts, err := pgx.CollectRows(rows, pgx.RowToStructByName[TagCount])
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// ParseTags splits a list of tags separated by commas or spaces, like "go, postgres sql", into unique lower case tags. It doesn't validate them, that's the job of the validator in the handler.
+func ParseTags(value string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+
+	tags := []string{}
+	for _, field := range fields {
+		if !slices.Contains(tags, field) {
+			tags = append(tags, field)
+		}
+	}
+
+	return tags
+}
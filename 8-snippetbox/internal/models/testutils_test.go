@@ -0,0 +1,46 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+/*
+newTestDB connects to the database in SNIPPETBOX_TEST_DSN, with every migration applied (see DATABASE.md), and skips the test when the variable isn't set. It should be a database of its own, tests add rows to it and only remove the ones they added.
+*/
+func newTestDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	dsn := os.Getenv("SNIPPETBOX_TEST_DSN")
+	if dsn == "" {
+		t.Skip("SNIPPETBOX_TEST_DSN is not set")
+	}
+
+	db, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	return db
+}
+
+// newTestUser adds a user with an email nobody else has, and deletes it with everything that references it when the test is over
+func newTestUser(t *testing.T, db *pgxpool.Pool) int {
+	t.Helper()
+
+	users := &UserModel{DB: db}
+
+	userID, err := users.Insert(context.Background(), "Test User", fmt.Sprintf("test-%d@example.com", time.Now().UnixNano()), "pa$$word123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec(context.Background(), `DELETE FROM users WHERE id = $1`, userID) })
+
+	return userID
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
@@ -18,14 +19,21 @@ type User struct {
 	Email          string
 	HashedPassword []byte
 	Created        time.Time
+	// Moderators can see the reports queue and act on it
+	Moderator bool
+	// Banned users can't log in anymore
+	Banned bool
+	// The locale the user picked, empty when their browser decides
+	Locale string
+	// The IANA time zone the user picked, empty when their browser decides
+	TimeZone string
 }
 
 type UserModel struct {
-	DB  *pgxpool.Pool
-	CTX context.Context
+	DB *pgxpool.Pool
 }
 
-func (m *UserModel) Insert(name, email, password string) (int, error) {
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) (int, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
 		// Wrap the error for context
@@ -42,8 +50,7 @@ func (m *UserModel) Insert(name, email, password string) (int, error) {
 
 	// Execute the query using QueryRow (since we expect one row back with RETURNING id)
 	// and scan the returned ID into the newId variable.
-	// Ensure m.CTX provides a valid context.
-	err = m.DB.QueryRow(m.CTX, statement, name, email, string(hashedPassword)).Scan(&newId)
+	err = m.DB.QueryRow(ctx, statement, name, email, string(hashedPassword)).Scan(&newId)
 	if err != nil {
 		// Check if the error is specifically a PostgreSQL error.
 		var pgErr *pgconn.PgError
@@ -65,13 +72,15 @@ func (m *UserModel) Insert(name, email, password string) (int, error) {
 	return newId, nil
 }
 
-func (m *UserModel) Authenticate(email, password string) (int, error) {
+func (m *UserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
 	var id int
 	var hashedPassword []byte
 
-	statement := "SELECT id, hashed_password FROM users WHERE email = $1"
+	var banned bool
 
-	err := m.DB.QueryRow(m.CTX, statement, email).Scan(&id, &hashedPassword)
+	statement := "SELECT id, hashed_password, banned FROM users WHERE email = $1"
+
+	err := m.DB.QueryRow(ctx, statement, email).Scan(&id, &hashedPassword, &banned)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return 0, ErrInvalidCredentials
@@ -89,15 +98,60 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 		}
 	}
 
+	// only checked once the password is right, so a ban isn't revealed to someone guessing passwords
+	if banned {
+		return 0, ErrBanned
+	}
+
 	return id, nil
 }
 
-func (m *UserModel) Exists(id int) (bool, error) {
-	var exists bool
+// Get returns a user without the password hash, the authenticate middleware uses it to check the user of a session still exists and isn't banned
+func (m *UserModel) Get(ctx context.Context, id int) (User, error) {
+	var user User
+
+	statement := "SELECT id, name, email, created, moderator, banned, locale, time_zone FROM users WHERE id = $1"
+
+	err := m.DB.QueryRow(ctx, statement, id).Scan(&user.ID, &user.Name, &user.Email, &user.Created, &user.Moderator, &user.Banned, &user.Locale, &user.TimeZone)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, ErrNoRecord
+		}
+
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// SetLocale saves the locale the user picked, an empty locale goes back to the one of the browser
+func (m *UserModel) SetLocale(ctx context.Context, id int, locale string) error {
+	_, err := m.DB.Exec(ctx, "UPDATE users SET locale = $2 WHERE id = $1", id, locale)
+
+	return err
+}
+
+// SetTimeZone saves the time zone the user picked, an empty one goes back to the one of the browser
+func (m *UserModel) SetTimeZone(ctx context.Context, id int, timeZone string) error {
+	_, err := m.DB.Exec(ctx, "UPDATE users SET time_zone = $2 WHERE id = $1", id, timeZone)
+
+	return err
+}
 
-	statement := "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)"
+// GetByEmail is used to find the user to share something with, it never returns the password hash
+func (m *UserModel) GetByEmail(ctx context.Context, email string) (User, error) {
+	var user User
 
-	err := m.DB.QueryRow(m.CTX, statement, id).Scan(&exists)
+	statement := "SELECT id, name, email, created FROM users WHERE email = $1"
+
+	err := m.DB.QueryRow(ctx, statement, email).Scan(&user.ID, &user.Name, &user.Email, &user.Created)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, ErrNoRecord
+		}
+
+		return User{}, err
+	}
 
-	return exists, err
+	return user, nil
 }
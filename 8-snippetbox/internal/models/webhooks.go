@@ -0,0 +1,288 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The events webhooks are sent for. Snippets can't be edited or deleted by their authors, so there is no snippet.updated or snippet.deleted (the README and the webhooks page say so too), a moderator hiding one is the only way one goes away before it expires.
+const (
+	WebhookSnippetCreated = "snippet.created"
+	WebhookSnippetHidden  = "snippet.hidden"
+	WebhookSnippetExpired = "snippet.expired"
+)
+
+// The states of a delivery, see the 0017_webhooks.sql migration
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+type Webhook struct {
+	ID     int
+	UserID int
+	URL    string
+	// Hex encoded, the key of the HMAC-SHA256 signature of every delivery
+	Secret  string
+	Created time.Time
+}
+
+// A delivery of an event to a webhook, with the URL and secret of the webhook so it can be sent without another query
+type WebhookDelivery struct {
+	ID             int
+	WebhookID      int
+	URL            string
+	Secret         string
+	Event          string
+	Payload        string
+	State          string
+	Attempts       int
+	NextAttempt    time.Time
+	ResponseStatus int
+	Error          string
+	Created        time.Time
+}
+
+// The JSON body of every delivery
+type WebhookPayload struct {
+	Event string `json:"event"`
+	// When the event happened, which is earlier than when it's sent when a delivery has to be retried
+	Created time.Time      `json:"created"`
+	Snippet WebhookSnippet `json:"snippet"`
+}
+
+// What deliveries tell about a snippet. The files aren't in it, they can be big, and the content of encrypted snippets is useless without the key anyway.
+type WebhookSnippet struct {
+	ID        int       `json:"id"`
+	Title     string    `json:"title"`
+	Tags      []string  `json:"tags"`
+	Private   bool      `json:"private"`
+	Encrypted bool      `json:"encrypted"`
+	Created   time.Time `json:"created"`
+	Expires   time.Time `json:"expires"`
+}
+
+/*
+WebhookModel stores webhooks and their outbox, the webhook_deliveries table.
+
+Events are added to the outbox by the models that make the changes, in their own transactions, see enqueueWebhooks. Sending them is up to the caller of Claim, which reports back with Delivered or Retry.
+*/
+type WebhookModel struct {
+	DB *pgxpool.Pool
+}
+
+// Insert adds a webhook for userID with a new secret
+func (m *WebhookModel) Insert(ctx context.Context, userID int, url string) (Webhook, error) {
+	statement := `INSERT INTO webhooks (user_id, url, secret, created) VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+  RETURNING id, user_id, url, secret, created`
+
+	rows, _ := m.DB.Query(ctx, statement, userID, url, randomHex(32))
+
+	return pgx.CollectOneRow(rows, pgx.RowToStructByName[Webhook])
+}
+
+// ForUser returns the webhooks of a user, the oldest first
+func (m *WebhookModel) ForUser(ctx context.Context, userID int) ([]Webhook, error) {
+	rows, _ := m.DB.Query(ctx, `SELECT id, user_id, url, secret, created FROM webhooks WHERE user_id = $1 ORDER BY id`, userID)
+	webhooks, err := pgx.CollectRows(rows, pgx.RowToStructByName[Webhook])
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// Delete deletes a webhook of userID along with its deliveries, it returns ErrNoRecord when the webhook isn't theirs
+func (m *WebhookModel) Delete(ctx context.Context, id, userID int) error {
+	tag, err := m.DB.Exec(ctx, `DELETE FROM webhooks WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+const deliveryColumns = `d.id, d.webhook_id, w.url, w.secret, d.event, d.payload, d.state, d.attempts, d.next_attempt,
+  d.response_status, d.error, d.created`
+
+// Deliveries returns the latest deliveries to the webhooks of a user, the most recent first
+func (m *WebhookModel) Deliveries(ctx context.Context, userID, limit int) ([]WebhookDelivery, error) {
+	statement := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+  WHERE w.user_id = $1 ORDER BY d.created DESC, d.id DESC LIMIT $2`
+
+	rows, _ := m.DB.Query(ctx, statement, userID, limit)
+	deliveries, err := pgx.CollectRows(rows, pgx.RowToStructByName[WebhookDelivery])
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+/*
+Claim returns up to limit deliveries that are due, and pushes their next attempt lease into the future. The lease is how long the caller has to send them and report back, a delivery that isn't reported by then, because the process died in the middle, is simply due again.
+
+SKIP LOCKED lets more than one instance claim at the same time without getting the same deliveries.
+*/
+func (m *WebhookModel) Claim(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	statement := `WITH due AS (
+    SELECT id FROM webhook_deliveries WHERE state = $1 AND next_attempt <= CURRENT_TIMESTAMP
+    ORDER BY next_attempt LIMIT $2 FOR UPDATE SKIP LOCKED
+  ), claimed AS (
+    UPDATE webhook_deliveries SET next_attempt = CURRENT_TIMESTAMP + make_interval(secs => $3)
+    WHERE id IN (SELECT id FROM due) RETURNING *
+  )
+  SELECT ` + deliveryColumns + ` FROM claimed d JOIN webhooks w ON w.id = d.webhook_id`
+
+	rows, _ := m.DB.Query(ctx, statement, DeliveryPending, limit, lease.Seconds())
+	deliveries, err := pgx.CollectRows(rows, pgx.RowToStructByName[WebhookDelivery])
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Delivered records a successful attempt
+func (m *WebhookModel) Delivered(ctx context.Context, id, status int) error {
+	statement := `UPDATE webhook_deliveries SET state = $2, attempts = attempts + 1, response_status = $3, error = ''
+  WHERE id = $1`
+
+	_, err := m.DB.Exec(ctx, statement, id, DeliveryDelivered, status)
+
+	return err
+}
+
+// Retry records a failed attempt, status is 0 when there was no response. The delivery is tried again after wait, or given up on when wait is 0.
+func (m *WebhookModel) Retry(ctx context.Context, id, status int, message string, wait time.Duration) error {
+	state := DeliveryPending
+	if wait == 0 {
+		state = DeliveryFailed
+	}
+
+	statement := `UPDATE webhook_deliveries SET state = $2, attempts = attempts + 1, response_status = $3, error = $4,
+    next_attempt = CURRENT_TIMESTAMP + make_interval(secs => $5)
+  WHERE id = $1`
+
+	_, err := m.DB.Exec(ctx, statement, id, state, status, message, wait.Seconds())
+
+	return err
+}
+
+/*
+EnqueueExpired adds the expired event of up to limit snippets that expired since the last call, and returns how many snippets that was. Hidden snippets are marked too, but their authors were already told they're gone.
+
+Like Claim, instances running this at the same time skip each other's snippets instead of announcing them twice.
+*/
+func (m *WebhookModel) EnqueueExpired(ctx context.Context, limit int) (int, error) {
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	statement := `UPDATE snippets SET expiry_announced = true WHERE id IN (
+    SELECT id FROM snippets WHERE NOT expiry_announced AND expires <= CURRENT_TIMESTAMP
+    ORDER BY expires LIMIT $1 FOR UPDATE SKIP LOCKED
+  ) RETURNING id, hidden`
+
+	rows, _ := tx.Query(ctx, statement, limit)
+
+	var ids []int
+	var id, count int
+	var hidden bool
+	_, err = pgx.ForEachRow(rows, []any{&id, &hidden}, func() error {
+		count++
+		if !hidden {
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = enqueueWebhooks(ctx, tx, WebhookSnippetExpired, ids...)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, tx.Commit(ctx)
+}
+
+/*
+Prune deletes up to limit deliveries that were delivered or given up on more than olderThan ago, and returns how many it deleted. Pending deliveries are kept however old they are, they still have to be sent.
+
+The outbox gets a row for every event and webhook, without this it would only ever grow. The webhooks page only shows the latest deliveries anyway.
+*/
+func (m *WebhookModel) Prune(ctx context.Context, olderThan time.Duration, limit int) (int, error) {
+	statement := `DELETE FROM webhook_deliveries WHERE id IN (
+    SELECT id FROM webhook_deliveries WHERE state <> $1 AND created < CURRENT_TIMESTAMP - make_interval(secs => $2)
+    ORDER BY created LIMIT $3 FOR UPDATE SKIP LOCKED
+  )`
+
+	tag, err := m.DB.Exec(ctx, statement, DeliveryPending, olderThan.Seconds(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+/*
+enqueueWebhooks adds an event about each snippet to the outbox, one delivery for every webhook of its author. It's called inside the transaction that makes the change, snippets without an author or whose author has no webhooks are skipped by the INSERT itself.
+*/
+func enqueueWebhooks(ctx context.Context, tx pgx.Tx, event string, snippetIDs ...int) error {
+	if len(snippetIDs) == 0 {
+		return nil
+	}
+
+	// no expiry or hidden filter, the snippets of these events are expired or hidden by definition
+	rows, _ := tx.Query(ctx, `SELECT `+snippetColumns+` FROM snippets s WHERE s.id = ANY($1)`, snippetIDs)
+	snippets, err := pgx.CollectRows(rows, pgx.RowToStructByName[Snippet])
+	if err != nil {
+		return err
+	}
+
+	for _, snippet := range snippets {
+		if snippet.UserID == 0 {
+			continue
+		}
+
+		payload, err := json.Marshal(WebhookPayload{
+			Event:   event,
+			Created: time.Now().UTC(),
+			Snippet: WebhookSnippet{
+				ID:        snippet.ID,
+				Title:     snippet.Title,
+				Tags:      snippet.Tags,
+				Private:   snippet.Private,
+				Encrypted: snippet.Encrypted,
+				Created:   snippet.Created.UTC(),
+				Expires:   snippet.Expires.UTC(),
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		statement := `INSERT INTO webhook_deliveries (webhook_id, event, payload, next_attempt, created)
+  SELECT id, $2, $3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP FROM webhooks WHERE user_id = $1`
+
+		_, err = tx.Exec(ctx, statement, snippet.UserID, event, string(payload))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+// claimedIDs returns the IDs of the deliveries Claim returned that are in ids, the database can have others that are due
+func claimedIDs(t *testing.T, m *WebhookModel, ids ...int) []int {
+	t.Helper()
+
+	deliveries, err := m.Claim(context.Background(), 100, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claimed []int
+	for _, delivery := range deliveries {
+		if slices.Contains(ids, delivery.ID) {
+			claimed = append(claimed, delivery.ID)
+		}
+	}
+	slices.Sort(claimed)
+
+	return claimed
+}
+
+/*
+Claim leases the deliveries it returns, so they aren't due again until the lease is over, and skips the ones another transaction holds a lock on, which is what lets several instances share the outbox.
+*/
+func TestWebhookModelClaim(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	webhooks := &WebhookModel{DB: db}
+
+	// the webhook and its deliveries go with the user
+	userID := newTestUser(t, db)
+
+	webhook, err := webhooks.Insert(ctx, userID, "https://example.com/hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int
+	for range 2 {
+		var id int
+		err := db.QueryRow(ctx, `INSERT INTO webhook_deliveries (webhook_id, event, payload, next_attempt, created)
+  VALUES ($1, $2, '{}', CURRENT_TIMESTAMP - INTERVAL '1 minute', CURRENT_TIMESTAMP) RETURNING id`, webhook.ID, WebhookSnippetCreated).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	locked, free := ids[0], ids[1]
+
+	// another instance in the middle of claiming the first delivery
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `SELECT id FROM webhook_deliveries WHERE id = $1 FOR UPDATE`, locked)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := claimedIDs(t, webhooks, ids...); !slices.Equal(got, []int{free}) {
+		t.Fatalf("got %v while %d is locked, want only %d", got, locked, free)
+	}
+
+	// the second one is leased now, and the first one still locked
+	if got := claimedIDs(t, webhooks, ids...); len(got) != 0 {
+		t.Fatalf("got %v, want nothing", got)
+	}
+
+	err = tx.Rollback(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := claimedIDs(t, webhooks, ids...); !slices.Equal(got, []int{locked}) {
+		t.Fatalf("got %v after the lock was released, want %d", got, locked)
+	}
+
+	// a failed attempt without a wait gives up, a delivered one is done, neither is due ever again
+	err = webhooks.Retry(ctx, locked, 500, "boom", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = webhooks.Delivered(ctx, free, 204)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err := webhooks.Deliveries(ctx, userID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	states := map[int]string{}
+	for _, delivery := range deliveries {
+		states[delivery.ID] = delivery.State
+		if delivery.Attempts != 1 {
+			t.Errorf("delivery %d: got %d attempts, want 1", delivery.ID, delivery.Attempts)
+		}
+	}
+
+	if states[locked] != DeliveryFailed || states[free] != DeliveryDelivered {
+		t.Errorf("got states %v, want %d %s and %d %s", states, locked, DeliveryFailed, free, DeliveryDelivered)
+	}
+}
+
+// Prune only deletes finished deliveries older than the retention, a pending one is kept however old it is
+func TestWebhookModelPrune(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	webhooks := &WebhookModel{DB: db}
+
+	userID := newTestUser(t, db)
+
+	webhook, err := webhooks.Insert(ctx, userID, "https://example.com/hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	insert := func(state string, age time.Duration) int {
+		t.Helper()
+
+		var id int
+		err := db.QueryRow(ctx, `INSERT INTO webhook_deliveries (webhook_id, event, payload, state, next_attempt, created)
+  VALUES ($1, $2, '{}', $3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP - make_interval(secs => $4)) RETURNING id`, webhook.ID, WebhookSnippetCreated, state, age.Seconds()).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return id
+	}
+
+	oldDelivered := insert(DeliveryDelivered, 48*time.Hour)
+	oldFailed := insert(DeliveryFailed, 48*time.Hour)
+	oldPending := insert(DeliveryPending, 48*time.Hour)
+	recent := insert(DeliveryDelivered, time.Hour)
+
+	_, err = webhooks.Prune(ctx, 24*time.Hour, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query(ctx, `SELECT id FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY id`, webhook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var left []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		left = append(left, id)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []int{oldPending, recent}; !slices.Equal(left, want) {
+		t.Errorf("got %v left, want %v, %d and %d should be gone", left, want, oldDelivered, oldFailed)
+	}
+}
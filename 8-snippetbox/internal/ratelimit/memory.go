@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Memory keeps the buckets in the memory of the process, use it when the application runs as a single instance. Create it with NewMemory.
+type Memory struct {
+	limit Limit
+
+	// Requests are served in their own goroutines, so the map is guarded by a mutex
+	mu        sync.Mutex
+	buckets   map[string]bucket
+	lastSweep time.Time
+}
+
+func NewMemory(limit Limit) *Memory {
+	return &Memory{
+		limit:     limit,
+		buckets:   map[string]bucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *Memory) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, found := m.buckets[key]
+	if !found {
+		b = bucket{tokens: float64(m.limit.Burst), updated: now}
+	}
+
+	tokens, ok, retryAfter := take(b.tokens, now.Sub(b.updated), m.limit)
+	m.buckets[key] = bucket{tokens: tokens, updated: now}
+
+	m.sweep(now)
+
+	return ok, retryAfter, nil
+}
+
+// sweep forgets the buckets that have had time to fill up again. It walks the whole map, so it only runs once per refill time, the caller must hold the mutex.
+func (m *Memory) sweep(now time.Time) {
+	refill := m.limit.refill()
+	if now.Sub(m.lastSweep) < refill {
+		return
+	}
+
+	for key, b := range m.buckets {
+		if now.Sub(b.updated) >= refill {
+			delete(m.buckets, key)
+		}
+	}
+
+	m.lastSweep = now
+}
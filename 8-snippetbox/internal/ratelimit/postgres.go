@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Postgres keeps the buckets in the rate_limits table, so every instance of the application shares them. Create it with NewPostgres.
+type Postgres struct {
+	db    *pgxpool.Pool
+	limit Limit
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewPostgres(db *pgxpool.Pool, limit Limit) *Postgres {
+	return &Postgres{
+		db:        db,
+		limit:     limit,
+		lastSweep: time.Now(),
+	}
+}
+
+/*
+Allow reads and writes the bucket in a transaction. SELECT ... FOR UPDATE locks the row until the transaction ends, so two instances taking a token from the same bucket at the same time wait for each other instead of both seeing the same number of tokens.
+
+The row has to exist to be locked, so a full bucket is inserted first, ON CONFLICT DO NOTHING leaves buckets that are already there alone.
+
+The time comes from the database and not from the instances, their clocks could disagree.
+*/
+func (p *Postgres) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	tx, err := p.db.Begin(ctx)
+	if err != nil {
+		return false, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `INSERT INTO rate_limits (key, tokens, updated) VALUES ($1, $2, CURRENT_TIMESTAMP) ON CONFLICT (key) DO NOTHING`, key, p.limit.Burst)
+	if err != nil {
+		return false, 0, err
+	}
+
+	var tokens, elapsed float64
+
+	err = tx.QueryRow(ctx, `SELECT tokens, EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - updated) FROM rate_limits WHERE key = $1 FOR UPDATE`, key).Scan(&tokens, &elapsed)
+	if err != nil {
+		return false, 0, err
+	}
+
+	tokens, ok, retryAfter := take(tokens, time.Duration(elapsed*float64(time.Second)), p.limit)
+
+	_, err = tx.Exec(ctx, `UPDATE rate_limits SET tokens = $2, updated = CURRENT_TIMESTAMP WHERE key = $1`, key, tokens)
+	if err != nil {
+		return false, 0, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return false, 0, err
+	}
+
+	err = p.sweep(ctx)
+	if err != nil {
+		return false, 0, err
+	}
+
+	return ok, retryAfter, nil
+}
+
+// sweep deletes the buckets that have had time to fill up again, at most once per refill time for each instance
+func (p *Postgres) sweep(ctx context.Context) error {
+	refill := p.limit.refill()
+
+	p.mu.Lock()
+	due := time.Since(p.lastSweep) >= refill
+	if due {
+		p.lastSweep = time.Now()
+	}
+	p.mu.Unlock()
+
+	if !due {
+		return nil
+	}
+
+	_, err := p.db.Exec(ctx, `DELETE FROM rate_limits WHERE updated < CURRENT_TIMESTAMP - make_interval(secs => $1)`, refill.Seconds())
+
+	return err
+}
@@ -0,0 +1,51 @@
+/*
+Package ratelimit implements token bucket rate limiting.
+
+Every key (a user, an IP address) gets a bucket that holds up to Limit.Burst tokens and starts full. Each request takes a token, and a new one drips in every Limit.Every, so a key can do Burst requests in a row and then one every Every after that. An empty bucket means the request is refused until the next token arrives.
+
+There are two backends with the same behaviour:
+
+  - Memory keeps the buckets in a map, it's fast but every instance of the application counts on its own
+  - Postgres keeps them in the rate_limits table, so several instances behind a load balancer share the same buckets
+
+Buckets that are full again are the same as buckets that were never used, so both backends forget them after a while to keep their storage small.
+
+Good read on the algorithm: https://en.wikipedia.org/wiki/Token_bucket
+*/
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limit is the shape of a bucket: it holds up to Burst tokens and gets a new one every Every
+type Limit struct {
+	Burst int
+	Every time.Duration
+}
+
+// refill is how long an empty bucket takes to be full again, after that it can be forgotten
+func (l Limit) refill() time.Duration {
+	return time.Duration(l.Burst) * l.Every
+}
+
+type Limiter interface {
+	// Allow takes a token from the bucket of key. When the bucket is empty it returns false, and how long until the next token arrives.
+	Allow(ctx context.Context, key string) (ok bool, retryAfter time.Duration, err error)
+}
+
+/*
+take is the token bucket itself, shared by the backends so they can't disagree. Instead of adding tokens on a timer, the bucket only stores how many tokens it had when it was last used, and the tokens that dripped in since then are added when it's used again.
+
+It returns the tokens left in the bucket, which is less than 1 when the request was refused, and how long until there is a whole token again.
+*/
+func take(tokens float64, elapsed time.Duration, limit Limit) (left float64, ok bool, retryAfter time.Duration) {
+	tokens = min(float64(limit.Burst), tokens+float64(elapsed)/float64(limit.Every))
+
+	if tokens >= 1 {
+		return tokens - 1, true, 0
+	}
+
+	return tokens, false, time.Duration((1 - tokens) * float64(limit.Every))
+}
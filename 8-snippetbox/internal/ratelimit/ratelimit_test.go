@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTake(t *testing.T) {
+	limit := Limit{Burst: 3, Every: time.Minute}
+
+	tests := []struct {
+		name           string
+		tokens         float64
+		elapsed        time.Duration
+		wantLeft       float64
+		wantOK         bool
+		wantRetryAfter time.Duration
+	}{
+		{"Full bucket", 3, 0, 2, true, 0},
+		{"Last token", 1, 0, 0, true, 0},
+		{"Empty bucket", 0, 0, 0, false, time.Minute},
+		{"Part of a token dripped in", 0, 15 * time.Second, 0.25, false, 45 * time.Second},
+		{"Whole token dripped in", 0, time.Minute, 0, true, 0},
+		{"Refill stops at the burst", 0, time.Hour, 2, true, 0},
+		{"Almost a token", 0.5, 20 * time.Second, 0.5 + 1.0/3, false, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			left, ok, retryAfter := take(tt.tokens, tt.elapsed, limit)
+
+			if ok != tt.wantOK {
+				t.Errorf("got ok %t, want %t", ok, tt.wantOK)
+			}
+			// the tokens are fractions of a minute, which floats can't always hold exactly
+			if diff := left - tt.wantLeft; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("got %v tokens left, want %v", left, tt.wantLeft)
+			}
+			if diff := retryAfter - tt.wantRetryAfter; diff > time.Millisecond || diff < -time.Millisecond {
+				t.Errorf("got retry after %s, want %s", retryAfter, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory(Limit{Burst: 2, Every: time.Hour})
+	ctx := context.Background()
+
+	for i := range 2 {
+		ok, _, err := m.Allow(ctx, "a")
+		if err != nil || !ok {
+			t.Fatalf("request %d: got %t, %v, want it allowed", i+1, ok, err)
+		}
+	}
+
+	ok, retryAfter, err := m.Allow(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("the third request in a row was allowed")
+	}
+	if retryAfter <= 59*time.Minute || retryAfter > time.Hour {
+		t.Errorf("got retry after %s, want about an hour", retryAfter)
+	}
+
+	// every key has a bucket of its own
+	ok, _, _ = m.Allow(ctx, "b")
+	if !ok {
+		t.Error("another key was refused")
+	}
+}
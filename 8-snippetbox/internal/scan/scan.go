@@ -0,0 +1,138 @@
+/*
+Package scan looks for things that shouldn't be posted in the content of snippets, like leaked credentials and spam.
+
+A Pipeline runs a list of detectors over the content, each one with its own Action: block the snippet, warn the user and let them confirm they really want to post it, or skip the detector altogether.
+*/
+package scan
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Action is what happens when a detector finds something
+type Action string
+
+const (
+	// Off skips the detector
+	Off Action = "off"
+	// Warn tells the user about the finding, they have to confirm before the snippet is posted
+	Warn Action = "warn"
+	// Block refuses the snippet until the finding is removed
+	Block Action = "block"
+)
+
+var Actions = []Action{Off, Warn, Block}
+
+type Detector interface {
+	// Name identifies the detector in the configuration, like "aws-keys"
+	Name() string
+	// Detect returns a message for every problem found in text
+	Detect(text string) []Message
+}
+
+/*
+Message is what a detector found, written to be displayed to the user. It's kept as a format string and its arguments, like "Found what looks like an AWS access key on line %s" and "3", so the application can translate the format string before the arguments go in. The format strings are in English, which is also what they read when nobody translates them.
+*/
+type Message struct {
+	Key  string
+	Args []any
+}
+
+func (m Message) String() string {
+	return fmt.Sprintf(m.Key, m.Args...)
+}
+
+type Finding struct {
+	Detector string
+	Action   Action
+	Message  Message
+}
+
+type stage struct {
+	detector Detector
+	action   Action
+}
+
+// Pipeline is the list of detectors to run, the zero value runs nothing. It's only changed while the application starts, so it's safe to Scan from many goroutines.
+type Pipeline struct {
+	stages []stage
+}
+
+// Add appends a detector to the pipeline, detectors added with Off are ignored
+func (p *Pipeline) Add(detector Detector, action Action) {
+	if action == Off {
+		return
+	}
+
+	p.stages = append(p.stages, stage{detector: detector, action: action})
+}
+
+// Detectors returns the names of the detectors that are run, in order
+func (p *Pipeline) Detectors() []string {
+	names := make([]string, 0, len(p.stages))
+	for _, s := range p.stages {
+		names = append(names, s.detector.Name())
+	}
+
+	return names
+}
+
+// Scan runs every detector over text and returns what they found, in the order of the pipeline
+func (p *Pipeline) Scan(text string) []Finding {
+	var findings []Finding
+
+	for _, s := range p.stages {
+		for _, message := range s.detector.Detect(text) {
+			findings = append(findings, Finding{Detector: s.detector.Name(), Action: s.action, Message: message})
+		}
+	}
+
+	return findings
+}
+
+// Blocking returns the findings that block, and Warnings the ones the user can confirm
+func Blocking(findings []Finding) []Finding {
+	return filter(findings, Block)
+}
+
+func Warnings(findings []Finding) []Finding {
+	return filter(findings, Warn)
+}
+
+func filter(findings []Finding, action Action) []Finding {
+	return slices.DeleteFunc(slices.Clone(findings), func(f Finding) bool {
+		return f.Action != action
+	})
+}
+
+// Messages joins the messages of findings into a single sentence list, the way field errors are displayed, with each one put through translate first
+func Messages(findings []Finding, translate func(key string, args ...any) string) string {
+	messages := make([]string, 0, len(findings))
+	for _, f := range findings {
+		messages = append(messages, translate(f.Message.Key, f.Message.Args...))
+	}
+
+	return strings.Join(messages, ". ")
+}
+
+// lineList formats line numbers for messages, like "3, 7, 12". Words like "line" and "and" are left to the message, so it can be translated as a whole.
+func lineList(lines []int) string {
+	numbers := make([]string, 0, len(lines))
+	for _, line := range lines {
+		numbers = append(numbers, fmt.Sprint(line))
+	}
+
+	return strings.Join(numbers, ", ")
+}
+
+// linesMessage picks between the messages for one line and for several, and puts the line numbers first in its arguments
+func linesMessage(one, other string, lines []int, args ...any) Message {
+	key := other
+	if len(lines) == 1 {
+		key = one
+	}
+
+	return Message{Key: key, Args: append([]any{lineList(lines)}, args...)}
+}
@@ -0,0 +1,58 @@
+package telemetry
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QueryTracer implements pgx.QueryTracer, pgx calls it around every query so each model method ends up as a child span of the request that triggered it.
+// It's set on the pool config, so the models don't need to know anything about tracing.
+type QueryTracer struct {
+	Tracer trace.Tracer
+}
+
+func NewQueryTracer(provider trace.TracerProvider) *QueryTracer {
+	return &QueryTracer{Tracer: provider.Tracer(ScopeName)}
+}
+
+func (t *QueryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	operation := queryOperation(data.SQL)
+
+	// The context we return here is the one pgx hands back to TraceQueryEnd, that's how we find the span again
+	ctx, _ = t.Tracer.Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBOperationName(operation),
+			// Our statements always use placeholders, so the text never contains user data
+			semconv.DBQueryText(data.SQL),
+		),
+	)
+
+	return ctx
+}
+
+func (t *QueryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	if data.Err != nil {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	}
+}
+
+// queryOperation returns the first keyword of a statement, like SELECT or INSERT, which is what the semantic conventions recommend as a span name
+func queryOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "query"
+	}
+
+	return strings.ToUpper(fields[0])
+}
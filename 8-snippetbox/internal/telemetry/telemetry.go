@@ -0,0 +1,62 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+/*
+  Tracing is split in two halves in OpenTelemetry:
+  - the API (go.opentelemetry.io/otel/trace) is what the application code talks to, it hands out spans.
+  - the SDK (go.opentelemetry.io/otel/sdk) decides what happens to those spans: sampling, batching and exporting them somewhere.
+
+  The application only ever sees a trace.TracerProvider, so turning tracing off is just a matter of handing it the no-op provider from the API, and tests can hand it an SDK provider that exports to tracetest.NewInMemoryExporter() instead of the network.
+
+  Docs: https://opentelemetry.io/docs/languages/go/
+*/
+
+// The instrumentation scope name, it shows up in every span so we know which code created it
+const ScopeName = "github.com/marlonmarcello/learning-go/8-snippetbox"
+
+// NoopProvider returns a provider whose spans do nothing, this is what we use when tracing is disabled.
+func NoopProvider() trace.TracerProvider {
+	return noop.NewTracerProvider()
+}
+
+// NewProvider creates an SDK provider that sends spans to exporter. Pass the OTLP exporter in production, or an in-memory exporter in tests.
+// The caller must call Shutdown on the returned provider before exiting, so spans still sitting in the batch are flushed.
+func NewProvider(exporter sdktrace.SpanExporter, serviceVersion string) (*sdktrace.TracerProvider, error) {
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName("snippetbox"),
+		semconv.ServiceVersion(serviceVersion),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		// If a caller already decided whether to sample this trace we follow their decision, otherwise we record everything
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+	)
+
+	return provider, nil
+}
+
+// NewOTLPExporter creates an exporter that sends spans over OTLP/HTTP to a collector, endpoint is a full URL like http://localhost:4318. Using the http:// scheme disables TLS.
+func NewOTLPExporter(ctx context.Context, endpoint string) (sdktrace.SpanExporter, error) {
+	return otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+}
+
+// Propagator reads and writes the W3C traceparent and baggage headers, so our spans join the trace of whoever called us.
+func Propagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
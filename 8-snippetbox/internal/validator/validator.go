@@ -72,3 +72,27 @@ func MinChars(value string, n int) bool {
 func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
 }
+
+// AllMatch is like Matches, but for every value of a list. An empty list passes.
+func AllMatch(values []string, rx *regexp.Regexp) bool {
+	for _, value := range values {
+		if !rx.MatchString(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func MaxItems[T any](values []T, n int) bool {
+	return len(values) <= n
+}
+
+// Tags are lower case letters, numbers and dashes, starting with a letter or number, up to 32 characters (the size of the tags.name column)
+var TagRX = regexp.MustCompile("^[a-z0-9][a-z0-9-]{0,31}$")
+
+// File names are letters, numbers, dots, dashes and underscores, so they are safe to use as paths in a zip archive. "." and ".." match too, the caller has to rule them out.
+var FileNameRX = regexp.MustCompile("^[A-Za-z0-9._-]+$")
+
+// The content of the files of encrypted snippets, as main.js writes it: a version, then the 12 bytes IV and the AES-GCM ciphertext, both in unpadded base64url
+var CiphertextRX = regexp.MustCompile(`^v1\.[A-Za-z0-9_-]{16}\.[A-Za-z0-9_-]+$`)
@@ -5,4 +5,281 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+
+// Dates are shown in the time zone of the browser unless the user picked one on the account page. The server can't know it from the request, so it's sent in a cookie, the first page ever is in UTC.
+(function () {
+	var zone = Intl.DateTimeFormat().resolvedOptions().timeZone;
+	if (zone) {
+		document.cookie = "tz=" + encodeURIComponent(zone) + "; path=/; max-age=31536000; samesite=lax; secure";
+	}
+})();
+
+// End-to-end encryption of snippets, with AES-GCM through WebCrypto. The key travels in the fragment of the URL, "#key=...", which browsers never send to the server, so the server only ever sees ciphertext. The format is "v1.<iv>.<ciphertext>", both in unpadded base64url, and the server checks for it.
+var snippetCrypto = {
+	toBase64url: function (bytes) {
+		var binary = "";
+		bytes.forEach(function (byte) {
+			binary += String.fromCharCode(byte);
+		});
+		return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+	},
+
+	fromBase64url: function (text) {
+		var binary = atob(text.replace(/-/g, "+").replace(/_/g, "/"));
+		return Uint8Array.from(binary, function (char) {
+			return char.charCodeAt(0);
+		});
+	},
+
+	// resolves to null when there is no key in the URL
+	keyFromHash: function () {
+		var match = window.location.hash.match(/key=([A-Za-z0-9_-]+)/);
+		if (!match) {
+			return Promise.resolve(null);
+		}
+		return crypto.subtle.importKey("raw", snippetCrypto.fromBase64url(match[1]), "AES-GCM", true, ["encrypt", "decrypt"]);
+	},
+
+	newKey: function () {
+		return crypto.subtle.generateKey({ name: "AES-GCM", length: 256 }, true, ["encrypt", "decrypt"]);
+	},
+
+	exportKey: function (key) {
+		return crypto.subtle.exportKey("raw", key).then(function (raw) {
+			return snippetCrypto.toBase64url(new Uint8Array(raw));
+		});
+	},
+
+	// every value gets its own random IV, reusing an IV with the same key breaks AES-GCM
+	encrypt: function (key, text) {
+		var iv = crypto.getRandomValues(new Uint8Array(12));
+		return crypto.subtle.encrypt({ name: "AES-GCM", iv: iv }, key, new TextEncoder().encode(text)).then(function (ciphertext) {
+			return "v1." + snippetCrypto.toBase64url(iv) + "." + snippetCrypto.toBase64url(new Uint8Array(ciphertext));
+		});
+	},
+
+	decrypt: function (key, value) {
+		var parts = value.split(".");
+		if (parts.length !== 3 || parts[0] !== "v1") {
+			return Promise.reject(new Error("unknown ciphertext format"));
+		}
+		return crypto.subtle.decrypt({ name: "AES-GCM", iv: snippetCrypto.fromBase64url(parts[1]) }, key, snippetCrypto.fromBase64url(parts[2])).then(function (plaintext) {
+			return new TextDecoder().decode(plaintext);
+		});
+	},
+};
+
+// File rows on the create page. Rows are cloned from the first one, and every new row gets an index that was never used, so rows can be removed from anywhere without renumbering the others.
+var snippetForm = document.getElementById("snippet-form");
+var files = document.getElementById("files");
+if (snippetForm && files) {
+	var nextIndex = files.querySelectorAll(".file").length;
+
+	document.getElementById("add-file").addEventListener("click", function () {
+		var row = files.querySelector(".file").cloneNode(true);
+		var index = nextIndex++;
+
+		row.querySelectorAll("[name]").forEach(function (field) {
+			field.name = field.name.replace(/^files\[\d+\]/, "files[" + index + "]");
+			if (field.tagName === "SELECT") {
+				field.selectedIndex = 0;
+			} else {
+				field.value = "";
+			}
+		});
+		row.querySelectorAll(".error").forEach(function (error) {
+			error.remove();
+		});
+		row.querySelector(".preview").hidden = true;
+
+		files.appendChild(row);
+		row.querySelector("input").focus();
+	});
+
+	files.addEventListener("click", function (event) {
+		if (!event.target.classList.contains("remove-file")) {
+			return;
+		}
+
+		// the last row is emptied instead, a snippet always needs one
+		var row = event.target.closest(".file");
+		if (files.querySelectorAll(".file").length > 1) {
+			row.remove();
+			return;
+		}
+
+		row.querySelectorAll("input, textarea").forEach(function (field) {
+			field.value = "";
+		});
+		updatePreview(row);
+	});
+
+	// Live markdown preview of each markdown file. The content is rendered by the server, through the same sanitizer as the view page, so the preview can be trusted to be safe to insert.
+	var encrypted = snippetForm.elements["encrypted"];
+	var uploads = snippetForm.elements["uploads"];
+
+	var updatePreview = function (row) {
+		var preview = row.querySelector(".preview");
+		// the preview is rendered by the server, which must never see the content of an encrypted snippet
+		if (encrypted.checked || row.querySelector("select").value !== "markdown") {
+			preview.hidden = true;
+			return;
+		}
+
+		preview.hidden = false;
+
+		// wait until the user stops typing for a moment instead of sending a request on every key press
+		clearTimeout(row.previewTimer);
+		row.previewTimer = setTimeout(function () {
+			var body = new URLSearchParams();
+			// nosurf checks the csrf_token field on every POST
+			body.set("csrf_token", snippetForm.elements["csrf_token"].value);
+			body.set("content", row.querySelector("textarea").value);
+
+			fetch(files.dataset.previewUrl, {
+				method: "POST",
+				body: body,
+				credentials: "same-origin",
+			}).then(function (response) {
+				if (!response.ok) {
+					throw new Error(response.statusText);
+				}
+				return response.text();
+			}).then(function (html) {
+				preview.querySelector(".markdown").innerHTML = html;
+			}).catch(function () {
+				preview.querySelector(".markdown").textContent = "Preview unavailable";
+			});
+		}, 300);
+	};
+
+	var onChange = function (event) {
+		var row = event.target.closest(".file");
+		if (row) {
+			updatePreview(row);
+		}
+	};
+
+	files.addEventListener("input", onChange);
+	files.addEventListener("change", onChange);
+	files.querySelectorAll(".file").forEach(updatePreview);
+
+	// uploads are read by the server, so they can't be used for encrypted snippets
+	var onEncryptedChange = function () {
+		uploads.disabled = encrypted.checked;
+		if (encrypted.checked) {
+			uploads.value = "";
+		}
+		files.querySelectorAll(".file").forEach(updatePreview);
+	};
+
+	encrypted.addEventListener("change", onEncryptedChange);
+	onEncryptedChange();
+
+	snippetForm.addEventListener("submit", function (event) {
+		if (!encrypted.checked) {
+			return;
+		}
+
+		event.preventDefault();
+
+		// a form that failed validation comes back with the key in the URL, reusing it keeps the link the same
+		snippetCrypto.keyFromHash().then(function (key) {
+			return key || snippetCrypto.newKey();
+		}).then(function (key) {
+			var textareas = Array.from(files.querySelectorAll("textarea"));
+			return Promise.all(textareas.map(function (textarea) {
+				if (textarea.value.trim() === "") {
+					return null;
+				}
+				return snippetCrypto.encrypt(key, textarea.value).then(function (value) {
+					textarea.value = value;
+				});
+			})).then(function () {
+				return snippetCrypto.exportKey(key);
+			});
+		}).then(function (exported) {
+			// browsers keep the fragment of the request when following the redirect to the new snippet, so that's where the key ends up
+			snippetForm.action = snippetForm.action.split("#")[0] + "#key=" + exported;
+			// submit() doesn't fire the submit event again
+			snippetForm.submit();
+		}).catch(function () {
+			alert("The snippet couldn't be encrypted, it was not sent.");
+		});
+	});
+
+	// after a failed validation the form comes back with the ciphertext, it's decrypted back with the key in the URL so it can be edited
+	if (encrypted.checked) {
+		snippetCrypto.keyFromHash().then(function (key) {
+			if (!key) {
+				return;
+			}
+			files.querySelectorAll("textarea").forEach(function (textarea) {
+				if (textarea.value.indexOf("v1.") === 0) {
+					snippetCrypto.decrypt(key, textarea.value).then(function (text) {
+						textarea.value = text;
+					});
+				}
+			});
+		});
+	}
+}
+
+// Decrypts encrypted snippets on the view page
+var encryptedFiles = document.querySelectorAll("pre.encrypted");
+if (encryptedFiles.length > 0) {
+	snippetCrypto.keyFromHash().then(function (key) {
+		if (!key) {
+			return;
+		}
+
+		// the key has to survive the redirects after starring or commenting, browsers keep the fragment of the request when the redirect doesn't have one
+		document.querySelectorAll("form").forEach(function (form) {
+			form.action = form.action.split("#")[0] + window.location.hash;
+		});
+
+		encryptedFiles.forEach(function (pre) {
+			snippetCrypto.decrypt(key, pre.dataset.ciphertext).then(function (text) {
+				// textContent, never innerHTML, the content is whatever the author typed
+				pre.textContent = text;
+			}).catch(function () {
+				pre.textContent = "This snippet couldn't be decrypted, the key in the link is wrong or incomplete.";
+			});
+		});
+	}).catch(function () {
+		encryptedFiles.forEach(function (pre) {
+			pre.textContent = "This snippet couldn't be decrypted, the key in the link is wrong or incomplete.";
+		});
+	});
+}
+
+// File tabs on the view page. The file shown is the one containing the element in the URL fragment, so links to a line or to a comment open the right tab.
+var fileTabs = document.querySelector(".file-tabs");
+if (fileTabs) {
+	var showFile = function (id) {
+		document.querySelectorAll("section.file").forEach(function (section) {
+			section.hidden = section.id !== id;
+		});
+		fileTabs.querySelectorAll("a").forEach(function (tab) {
+			tab.classList.toggle("active", tab.dataset.file === id);
+		});
+	};
+
+	var showFileOfHash = function () {
+		var target = window.location.hash && document.getElementById(window.location.hash.slice(1));
+		var section = target && target.closest("section.file");
+		showFile(section ? section.id : fileTabs.querySelector("a").dataset.file);
+	};
+
+	fileTabs.addEventListener("click", function (event) {
+		var tab = event.target.closest("a");
+		if (tab) {
+			event.preventDefault();
+			showFile(tab.dataset.file);
+		}
+	});
+
+	window.addEventListener("hashchange", showFileOfHash);
+	showFileOfHash();
+}